@@ -1,42 +1,100 @@
 package gowhistler
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/pkg/errors"
+	"go/format"
+	"go/token"
 	"io"
 	"os"
+	"sort"
 	"strings"
 )
 
-
 type goTypeName struct {
 	Type string
-	TODO: xml-tag vars
+	// TODO: xml-tag vars
 }
 
 type Builder struct {
-	Types map[string]string
-	Vars  map[string]string
+	Types   map[string]string
+	Vars    map[string]string
+	Decls   map[string]string // other top level declarations (clients, functions), by name
+	Imports map[string]bool
+}
+
+func NewBuilder() *Builder {
+	return &Builder{
+		Types:   make(map[string]string),
+		Vars:    make(map[string]string),
+		Decls:   make(map[string]string),
+		Imports: make(map[string]bool),
+	}
 }
 
 func (b *Builder) OutputTypes(w io.Writer) {
-	for name, def := range b.Types {
-		fmt.Fprintf(w, "type %s %s\n", name, def)
+	for _, name := range sortedKeys(b.Types) {
+		fmt.Fprintf(w, "type %s %s\n", name, b.Types[name])
 	}
 
 	fmt.Fprintf(w, "\n\n")
-	for name, tp := range b.Vars {
-		fmt.Fprintf(w, "var %s %s\n", name, tp)
+	for _, name := range sortedKeys(b.Vars) {
+		fmt.Fprintf(w, "var %s %s\n", name, b.Vars[name])
+	}
+
+	for _, name := range sortedKeys(b.Decls) {
+		fmt.Fprintf(w, "\n%s\n", b.Decls[name])
+	}
+}
+
+// Output writes the complete go source of the package
+func (b *Builder) Output(w io.Writer, pkg string) {
+	fmt.Fprintf(w, "package %s\n\n", pkg)
+
+	imports := make([]string, 0, len(b.Imports))
+	for imp := range b.Imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	fmt.Fprintf(w, "import (\n")
+	for _, imp := range imports {
+		fmt.Fprintf(w, "%q\n", imp)
+	}
+	fmt.Fprintf(w, ")\n\n")
+
+	b.OutputTypes(w)
+}
+
+// useType registers the imports needed to refer to a go type
+func (b *Builder) useType(goType string) {
+	switch goType = strings.TrimLeft(goType, "*[]"); {
+	case strings.HasPrefix(goType, "time."):
+		b.Imports["time"] = true
+	case strings.HasPrefix(goType, "soap."):
+		b.Imports["github.com/keanpedersen/gowhistler/soap"] = true
 	}
 }
 
 func (wsdl *WSDL) Build() error {
 
-	builder := &Builder{
-		Types: make(map[string]string),
-		Vars:  make(map[string]string),
+	buf := &bytes.Buffer{}
+	if err := wsdl.Generate(buf, "output"); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile("output/struct.go", buf.Bytes(), 0664); err != nil {
+		return errors.WithStack(err)
 	}
 
+	return nil
+}
+
+// Generate writes the types and clients of the WSDL as a go package named pkg
+func (wsdl *WSDL) Generate(w io.Writer, pkg string) error {
+
+	builder := NewBuilder()
+
 	for _, message := range wsdl.Messages {
 		if err := wsdl.BuildMessage(builder, message); err != nil {
 			return err
@@ -44,22 +102,26 @@ func (wsdl *WSDL) Build() error {
 	}
 
 	for _, service := range wsdl.Services {
-		if err := wsdl.BuildService(service); err != nil {
+		if err := wsdl.BuildService(builder, service); err != nil {
 			return err
 		}
 	}
 
-	f, err := os.Create("output/struct.go")
-	if err != nil {
-		return errors.WithStack(err)
+	if err := wsdl.BuildDocuments(builder); err != nil {
+		return err
 	}
 
-	f.WriteString("package output\n\n")
-	f.WriteString("import \"time\"\n\n")
+	src := &bytes.Buffer{}
+	builder.Output(src, pkg)
 
-	builder.OutputTypes(f)
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "Could not format generated code")
+	}
 
-	f.Close()
+	if _, err := w.Write(formatted); err != nil {
+		return errors.WithStack(err)
+	}
 
 	return nil
 }
@@ -70,6 +132,11 @@ func (wsdl *WSDL) BuildMessage(builder *Builder, message Message) error {
 
 	for _, part := range message.Parts {
 
+		if part.Element == "" {
+			// type based parts only exist inside rpc wrappers
+			continue
+		}
+
 		fmt.Printf("Building part %v of type %v\n", part.Name, part.Element)
 
 		tp, ok := wsdl.TypeMap[strings.ToLower(part.Element)]
@@ -81,6 +148,7 @@ func (wsdl *WSDL) BuildMessage(builder *Builder, message Message) error {
 			return err
 		}
 
+		builder.useType(tp.TypeName())
 		builder.Vars[ucFirst(message.Name+"_"+part.Name)] = tp.TypeName()
 
 	}
@@ -88,6 +156,34 @@ func (wsdl *WSDL) BuildMessage(builder *Builder, message Message) error {
 	return nil
 }
 
+// elementField finds the name, type and xml tag of the struct field generated for a sub element
+func (wsdl *WSDL) elementField(sub Element) (name string, tp ElementType, tag string, err error) {
+
+	if sub.Reference != "" {
+		subTp, ok := wsdl.TypeMap[strings.ToLower(sub.ReferenceNameSpace+":"+sub.Reference)]
+		if !ok {
+			return "", tp, "", errors.Errorf("Could not find reference of type %v:%v", sub.ReferenceNameSpace, sub.Reference)
+		}
+
+		return makeTypeName(fmt.Sprintf("%v__%v", sub.ReferenceNameSpace, sub.Reference)), subTp, fmt.Sprintf("`xml:\"%s %s\"`", sub.ReferenceNameSpace, sub.Reference), nil
+	}
+
+	subTpName := sub.ElementType
+	if !strings.Contains(sub.ElementType, ":") {
+		subTpName = sub.NameSpace + ":" + subTpName
+	}
+	subTp, ok := wsdl.TypeMap[strings.ToLower(subTpName)]
+	if !ok {
+		return "", tp, "", errors.Errorf("Could not find reference of type %v", subTpName)
+	}
+
+	// unqualified local elements are named by the field, in no namespace
+	if !sub.Unqualified && sub.NameSpace != "" {
+		tag = fmt.Sprintf("`xml:\"%s %s\"`", sub.NameSpace, sub.Name)
+	}
+	return sub.Name, subTp, tag, nil
+}
+
 func (wsdl *WSDL) BuildType(builder *Builder, tp ElementType) error {
 
 	if tp.BuildIn != "" {
@@ -95,66 +191,41 @@ func (wsdl *WSDL) BuildType(builder *Builder, tp ElementType) error {
 		return nil
 	}
 
-	thisType := ""
-	if len(tp.SubElements) > 0 || len(tp.ChoiceElements) > 0 || len(tp.AttributeElements) > 0 {
+	if _, ok := builder.Types[tp.TypeName()]; ok {
+		// already built, or being built further up the stack
+		return nil
+	}
+	builder.Types[tp.TypeName()] = "struct{}"
+
+	thisType := "struct{}"
+	if isStruct(tp) {
 		thisType = "struct {\n"
 
 		for _, sub := range tp.SubElements {
-			if sub.Reference != "" {
-				subTp, ok := wsdl.TypeMap[strings.ToLower(sub.ReferenceNameSpace+":"+sub.Reference)]
-				if !ok {
-					return errors.Errorf("Could not find reference of type %v:%v", sub.ReferenceNameSpace, sub.Reference)
-				}
-
-				thisType += fmt.Sprintf("%s %s `xml:\"%s\"`\n", makeTypeName(fmt.Sprintf("%v__%v ", sub.ReferenceNameSpace, sub.Reference)), subTp.TypeName(), sub.Reference)
-
-				if err := wsdl.BuildType(builder, subTp); err != nil {
-					return err
-				}
-			} else {
-				subTpName := sub.ElementType
-				if !strings.Contains(sub.ElementType, ":") {
-					subTpName = sub.NameSpace + ":" + subTpName
-				}
-				subTp, ok := wsdl.TypeMap[strings.ToLower(subTpName)]
-				if !ok {
-					return errors.Errorf("Could not find reference of type %v", subTpName)
-				}
-				if err := wsdl.BuildType(builder, subTp); err != nil {
-					return err
-				}
-				thisType += fmt.Sprintf("%s %s\n", sub.Name, subTp.TypeName())
+			name, subTp, tag, err := wsdl.elementField(sub)
+			if err != nil {
+				return err
 			}
+			if err := wsdl.BuildType(builder, subTp); err != nil {
+				return err
+			}
+			builder.useType(subTp.TypeName())
+			thisType += fmt.Sprintf("%s %s %s\n", name, subTp.TypeName(), tag)
 		}
 		for _, sub := range tp.ChoiceElements {
-			if sub.Reference != "" {
-				subTp, ok := wsdl.TypeMap[strings.ToLower(sub.ReferenceNameSpace+":"+sub.Reference)]
-				if !ok {
-					return errors.Errorf("Could not find reference of type %v:%v", sub.ReferenceNameSpace, sub.Reference)
-				}
-
-				thisType += fmt.Sprintf("%s *%s `xml:\"%s\"`\n", makeTypeName(fmt.Sprintf("%v__%v ", sub.ReferenceNameSpace, sub.Reference)), subTp.TypeName(), sub.Reference)
-
-				if err := wsdl.BuildType(builder, subTp); err != nil {
-					return err
-				}
-			} else {
-				subTpName := sub.ElementType
-				if !strings.Contains(sub.ElementType, ":") {
-					subTpName = sub.NameSpace + ":" + subTpName
-				}
-				subTp, ok := wsdl.TypeMap[strings.ToLower(subTpName)]
-				if !ok {
-					return errors.Errorf("Could not find reference of type %v", subTpName)
-				}
-				if err := wsdl.BuildType(builder, subTp); err != nil {
-					return err
-				}
-				thisType += fmt.Sprintf("%s *%s\n", sub.Name, subTp.TypeName())
+			name, subTp, tag, err := wsdl.elementField(sub)
+			if err != nil {
+				return err
+			}
+			if err := wsdl.BuildType(builder, subTp); err != nil {
+				return err
 			}
+			builder.useType(subTp.TypeName())
+			thisType += fmt.Sprintf("%s *%s %s\n", name, subTp.TypeName(), tag)
 		}
 
-		for name, subTpName := range tp.AttributeElements {
+		for _, name := range sortedKeys(tp.AttributeElements) {
+			subTpName := tp.AttributeElements[name]
 
 			subTp, ok := wsdl.TypeMap[strings.ToLower(subTpName)]
 			if !ok {
@@ -163,32 +234,41 @@ func (wsdl *WSDL) BuildType(builder *Builder, tp ElementType) error {
 			if err := wsdl.BuildType(builder, subTp); err != nil {
 				return err
 			}
+			builder.useType(subTp.TypeName())
 			thisType += fmt.Sprintf("%s %s `xml:\",attr\"`\n", ucFirst(name), subTp.TypeName())
 
 		}
 
 		thisType += "}"
+	} else if tp.ListItem != "" {
+		var err error
+		if thisType, err = wsdl.buildList(builder, tp); err != nil {
+			return err
+		}
+	} else if len(tp.UnionMembers) > 0 {
+		var err error
+		if thisType, err = wsdl.buildUnion(builder, tp); err != nil {
+			return err
+		}
 	} else if tp.Type != "" {
 		subTp, ok := wsdl.TypeMap[strings.ToLower(tp.Type)]
 		if !ok {
 			return errors.Errorf("Could not find reference of type %v", tp.Type)
 		}
 
-		if subTp.BuildIn != "" {
-			thisType = subTp.BuildIn
-		} else {
-			if err := wsdl.BuildType(builder, subTp); err != nil {
-				return err
-			}
+		if err := wsdl.BuildType(builder, subTp); err != nil {
+			return err
 		}
+		builder.useType(subTp.TypeName())
+		thisType = subTp.TypeName()
 	}
 
 	builder.Types[tp.TypeName()] = thisType
 
-	return nil
+	return wsdl.buildValidate(builder, tp)
 }
 
-func (wsdl *WSDL) BuildService(service Service) error {
+func (wsdl *WSDL) BuildService(builder *Builder, service Service) error {
 
 	fmt.Printf("Building service %v\n", service.Name)
 
@@ -199,39 +279,723 @@ func (wsdl *WSDL) BuildService(service Service) error {
 			return err
 		}
 
+		portType, err := wsdl.FindPort(binding.Type)
+		if err != nil {
+			return err
+		}
+
 		fmt.Printf("Binding %s found for port %s\n", binding.Name, port.Name)
 
 		fmt.Printf("Port %s is at address %s\n", port.Name, port.AddressLocation)
 
+		portName := makeTypeName(port.Name)
+		clientName := portName + "Client"
+		builder.Imports["github.com/keanpedersen/gowhistler/soap"] = true
+
+		builder.Decls[clientName] = fmt.Sprintf(`// %[1]sAddress is the location of the %[2]s port of the %[3]s service
+const %[1]sAddress = %[4]q
+
+// %[1]s is a client of the %[2]s port of the %[3]s service
+type %[1]s struct {
+	*soap.Client
+}
+
+// New%[1]s creates a client sending requests to url, pass %[1]sAddress to use the location from the WSDL
+func New%[1]s(url string, opts ...soap.ClientOption) *%[1]s {
+	return &%[1]s{Client: soap.NewClient(url, opts...)}
+}`, clientName, port.Name, service.Name, port.AddressLocation)
+
+		var ops []goOperation
 		for _, op := range binding.Operations {
-			if err := wsdl.BuildOperation(op); err != nil {
+			goOp, err := wsdl.BuildOperation(builder, portName, portType, op)
+			if err != nil {
 				return err
 			}
+			buildClientMethod(builder, clientName, goOp)
+			ops = append(ops, goOp)
 		}
+
+		buildServer(builder, portName, port.Name, service.Name, ops)
+		buildMock(builder, portName, port.Name, ops)
 	}
 
 	return nil
 }
 
-func (wsdl *WSDL) BuildOperation(op BindingOperation) error {
+// operationBody is the element sent or received in the SOAP body of an operation
+type operationBody struct {
+	NameSpace string
+	Name      string
+	TypeName  string // empty when the body is empty
+}
+
+// operationHeader is a SOAP header block of an operation, given by soap:header
+type operationHeader struct {
+	NameSpace string
+	Name      string
+	Field     string
+	TypeName  string
+	Validate  bool // the type is generated, with a Validate method
+}
+
+// goOperation is the go code built for a binding operation, shared by clients and servers
+type goOperation struct {
+	Name          string // go method name
+	Operation     string // name of the soap.Operation variable
+	Input         operationBody
+	Output        operationBody
+	InputHeaders  string // type of the request headers, empty without soap:header
+	OutputHeaders string // type of the response headers, empty without soap:header
+
+	InputAttachments  string // type of the request attachments, empty without mime:content
+	OutputAttachments string // type of the response attachments, empty without mime:content
+}
+
+// params returns the parameters of the go methods of the operation
+func (op goOperation) params() []string {
+	var params []string
+	if op.Input.TypeName != "" {
+		params = append(params, "request *"+op.Input.TypeName)
+	}
+	if op.InputHeaders != "" {
+		params = append(params, "headers *"+op.InputHeaders)
+	}
+	if op.InputAttachments != "" {
+		params = append(params, "attachments *"+op.InputAttachments)
+	}
+	return params
+}
+
+// results returns the results of the go methods of the operation
+func (op goOperation) results() []string {
+	var results []string
+	if op.Output.TypeName != "" {
+		results = append(results, "*"+op.Output.TypeName)
+	}
+	if op.OutputHeaders != "" {
+		results = append(results, "*"+op.OutputHeaders)
+	}
+	if op.OutputAttachments != "" {
+		results = append(results, "*"+op.OutputAttachments)
+	}
+	return append(results, "error")
+}
+
+// requestEnvelope and responseEnvelope are the soap.Envelope literals holding the values of params and results
+func (op goOperation) requestEnvelope() soapEnvelope {
+	ret := soapEnvelope{Headers: "nil", Body: "nil", Attachments: "nil"}
+	if op.Input.TypeName != "" {
+		ret.Body = "request"
+	}
+	if op.InputHeaders != "" {
+		ret.Headers = "headers.soapHeaders()"
+	}
+	if op.InputAttachments != "" {
+		ret.Attachments = "attachments.soapAttachments()"
+	}
+	return ret
+}
+
+func (op goOperation) responseEnvelope() soapEnvelope {
+	ret := soapEnvelope{Headers: "nil", Body: "nil", Attachments: "nil"}
+	if op.Output.TypeName != "" {
+		ret.Body = "response"
+	}
+	if op.OutputHeaders != "" {
+		ret.Headers = "responseHeaders.soapHeaders()"
+	}
+	if op.OutputAttachments != "" {
+		ret.Attachments = "responseAttachments.soapAttachments()"
+	}
+	return ret
+}
+
+// responseValues names the results, ending with the error
+func (op goOperation) responseValues(err string) []string {
+	var values []string
+	if op.Output.TypeName != "" {
+		values = append(values, "response")
+	}
+	if op.OutputHeaders != "" {
+		values = append(values, "responseHeaders")
+	}
+	if op.OutputAttachments != "" {
+		values = append(values, "responseAttachments")
+	}
+	return append(values, err)
+}
+
+// newValues declares the named values of an envelope
+func newValues(body operationBody, headers, attachments string, bodyName, headersName, attachmentsName string) string {
+	ret := ""
+	if body.TypeName != "" {
+		ret += fmt.Sprintf("%s := new(%s)\n", bodyName, body.TypeName)
+	}
+	if headers != "" {
+		ret += fmt.Sprintf("%s := new(%s)\n", headersName, headers)
+	}
+	if attachments != "" {
+		ret += fmt.Sprintf("%s := new(%s)\n", attachmentsName, attachments)
+	}
+	return ret
+}
+
+func (wsdl *WSDL) BuildOperation(builder *Builder, portName string, port Port, op BindingOperation) (goOp goOperation, err error) {
 
 	fmt.Printf("Building operation %v at %v\n", op.Name, op.SoapAction)
 
+	portOp, err := port.FindOperation(op.Name)
+	if err != nil {
+		return goOp, err
+	}
+
 	for _, component := range op.Input {
 		if err := wsdl.BuildOperationComponent(component, "input"); err != nil {
-			return err
+			return goOp, err
 		}
 	}
 	for _, component := range op.Output {
 		if err := wsdl.BuildOperationComponent(component, "output"); err != nil {
-			return err
+			return goOp, err
 		}
 	}
 	for _, component := range op.Fault {
 		if err := wsdl.BuildOperationComponent(component, "fault"); err != nil {
+			return goOp, err
+		}
+	}
+
+	goOp.Name = makeTypeName(op.Name)
+	goOp.Operation = lcFirst(portName) + goOp.Name + "Operation"
+	typePrefix := portName + "_" + goOp.Name
+
+	goOp.Input, err = wsdl.buildOperationBody(builder, typePrefix, op, portOp.Input.Message, op.Input, false)
+	if err != nil {
+		return goOp, err
+	}
+	goOp.Output, err = wsdl.buildOperationBody(builder, typePrefix, op, portOp.Output.Message, op.Output, true)
+	if err != nil {
+		return goOp, err
+	}
+
+	goOp.InputHeaders, err = wsdl.buildOperationHeaders(builder, typePrefix+"_RequestHeaders", op.Input)
+	if err != nil {
+		return goOp, err
+	}
+	goOp.OutputHeaders, err = wsdl.buildOperationHeaders(builder, typePrefix+"_ResponseHeaders", op.Output)
+	if err != nil {
+		return goOp, err
+	}
+
+	goOp.InputAttachments, err = wsdl.buildOperationAttachments(builder, typePrefix+"_RequestAttachments", portOp.Input.Message, op.Input)
+	if err != nil {
+		return goOp, err
+	}
+	goOp.OutputAttachments, err = wsdl.buildOperationAttachments(builder, typePrefix+"_ResponseAttachments", portOp.Output.Message, op.Output)
+	if err != nil {
+		return goOp, err
+	}
+
+	faults := ""
+	for _, portFault := range portOp.Faults {
+		fault, err := wsdl.buildFault(builder, portFault.Message)
+		if err != nil {
+			return goOp, err
+		}
+		faults += fault + ",\n"
+	}
+
+	// WS-Addressing is used when the binding asks for it, or the port type gives the actions
+	addressing := ""
+	if op.Addressing || portOp.Input.Action != "" {
+		outputAction := ""
+		if portOp.Output.Message != "" {
+			outputAction = wsdl.messageAction(port.Name, portOp.Output, op.Name+"Response")
+		}
+		addressing = fmt.Sprintf("Addressing: true,\nInputAction: %q,\nOutputAction: %q,\n",
+			wsdl.messageAction(port.Name, portOp.Input, op.Name+"Request"), outputAction)
+	}
+
+	builder.Imports["encoding/xml"] = true
+
+	builder.Decls[goOp.Operation] = fmt.Sprintf(`var %s = soap.Operation{
+	Name:     %q,
+	Action:   %q,
+	Style:    %q,
+	Request:  xml.Name{Space: %q, Local: %q},
+	Response: xml.Name{Space: %q, Local: %q},
+	Faults: []soap.FaultType{
+%s	},
+%s}`, goOp.Operation, op.Name, op.SoapAction, op.Style, goOp.Input.NameSpace, goOp.Input.Name, goOp.Output.NameSpace, goOp.Output.Name, faults, addressing)
+
+	return goOp, nil
+}
+
+// messageAction returns the WS-Addressing action of a port type input or output, defaulting to the target
+// namespace, port type and message name joined as given by WS-Addressing Metadata
+func (wsdl *WSDL) messageAction(portName string, component PortOperationComponent, defaultName string) string {
+
+	if component.Action != "" {
+		return component.Action
+	}
+
+	name := component.Name
+	if name == "" {
+		name = defaultName
+	}
+	delimiter := "/"
+	if strings.HasPrefix(wsdl.TargetNamespace, "urn:") {
+		delimiter = ":"
+	}
+	return strings.TrimSuffix(wsdl.TargetNamespace, delimiter) + delimiter + portName + delimiter + name
+}
+
+// buildClientMethod builds the client method calling an operation
+func buildClientMethod(builder *Builder, clientName string, op goOperation) {
+
+	zeros := op.responseValues("err")
+	for i := 0; i < len(zeros)-1; i++ {
+		zeros[i] = "nil"
+	}
+
+	builder.Imports["context"] = true
+	params := append([]string{"ctx context.Context"}, op.params()...)
+	params = append(params, "opts ...soap.CallOption")
+
+	method := fmt.Sprintf("// %s calls the %s operation\n", op.Name, op.Name)
+	method += fmt.Sprintf("func (c *%s) %s(%s) (%s) {\n", clientName, op.Name, strings.Join(params, ", "), strings.Join(op.results(), ", "))
+	method += newValues(op.Output, op.OutputHeaders, op.OutputAttachments, "response", "responseHeaders", "responseAttachments")
+	method += fmt.Sprintf("if err := c.Call(ctx, %s, %s, %s, opts...); err != nil {\n", op.Operation, op.requestEnvelope(), op.responseEnvelope())
+	method += fmt.Sprintf("return %s\n}\n", strings.Join(zeros, ", "))
+	method += fmt.Sprintf("return %s\n}", strings.Join(op.responseValues("nil"), ", "))
+
+	builder.Decls[clientName+"."+op.Name] = method
+}
+
+// buildFault builds the typed error of a fault message, returning the soap.FaultType literal decoding it
+func (wsdl *WSDL) buildFault(builder *Builder, messageName string) (string, error) {
+
+	message, err := wsdl.FindMessage(messageName)
+	if err != nil {
+		return "", err
+	}
+
+	if len(message.Parts) != 1 || message.Parts[0].Element == "" {
+		return "", errors.Errorf("Fault message %v must have a single element part", message.Name)
+	}
+	part := message.Parts[0]
+
+	tp, ok := wsdl.TypeMap[strings.ToLower(part.Element)]
+	if !ok {
+		return "", errors.Errorf("Could not find element of type %v", part.Element)
+	}
+	if err := wsdl.BuildType(builder, tp); err != nil {
+		return "", err
+	}
+	builder.useType(tp.TypeName())
+
+	errName := makeTypeName(message.Name) + "Error"
+	builder.Decls[errName] = fmt.Sprintf(`// %[1]s is returned when a SOAP fault carries the detail of the %[2]s fault message
+type %[1]s struct {
+	Fault  *soap.Fault
+	Detail *%[3]s
+}
+
+func (e *%[1]s) Error() string {
+	if e.Fault == nil {
+		return %[2]q
+	}
+	return e.Fault.Error()
+}
+
+func (e *%[1]s) Unwrap() error {
+	if e.Fault == nil {
+		return nil
+	}
+	return e.Fault
+}
+
+// FaultDetail implements soap.DetailError
+func (e *%[1]s) FaultDetail() interface{} {
+	return e.Detail
+}`, errName, message.Name, tp.TypeName())
+
+	ns, name := splitFullName(part.Element)
+	return fmt.Sprintf(`		{
+			Detail: xml.Name{Space: %q, Local: %q},
+			New: func(fault *soap.Fault) soap.DetailError {
+				return &%s{Fault: fault, Detail: new(%s)}
+			},
+		}`, ns, name, errName, tp.TypeName()), nil
+}
+
+// soapEnvelope is the go expression of a soap.Envelope literal in generated code
+type soapEnvelope struct {
+	Headers     string
+	Body        string
+	Attachments string
+}
+
+func (e soapEnvelope) String() string {
+	if e.Attachments != "nil" {
+		return fmt.Sprintf("&soap.Envelope{Headers: %s, Body: %s, Attachments: %s}", e.Headers, e.Body, e.Attachments)
+	}
+	return fmt.Sprintf("&soap.Envelope{Headers: %s, Body: %s}", e.Headers, e.Body)
+}
+
+// names returns the variables the envelope is made of
+func (e soapEnvelope) names() []string {
+	var ret []string
+	if e.Body != "nil" {
+		ret = append(ret, e.Body)
+	}
+	if e.Headers != "nil" {
+		ret = append(ret, strings.TrimSuffix(e.Headers, ".soapHeaders()"))
+	}
+	if e.Attachments != "nil" {
+		ret = append(ret, strings.TrimSuffix(e.Attachments, ".soapAttachments()"))
+	}
+	return ret
+}
+
+// buildOperationHeaders builds a struct holding the soap:header blocks of the input or output of an operation,
+// with a soapHeaders method listing them for soap.Envelope. It returns the name of the struct, or "" when there
+// are no headers.
+func (wsdl *WSDL) buildOperationHeaders(builder *Builder, typeName string, components []BindingOperationComponent) (string, error) {
+
+	var headers []operationHeader
+	for _, component := range components {
+		if component.In != "header" {
+			continue
+		}
+
+		message, err := wsdl.FindMessage(component.Message)
+		if err != nil {
+			return "", err
+		}
+
+		for _, part := range bodyParts(message, component) {
+			header := operationHeader{
+				Field: makeTypeName(part.Name),
+			}
+
+			var tp ElementType
+			var ok bool
+			if part.Element != "" {
+				tp, ok = wsdl.TypeMap[strings.ToLower(part.Element)]
+				header.NameSpace, header.Name = splitFullName(part.Element)
+			} else {
+				tp, ok = wsdl.TypeMap[strings.ToLower(part.Type)]
+				header.Name = part.Name
+			}
+			if !ok {
+				return "", errors.Errorf("Could not find header part %v of message %v", part.Name, message.Name)
+			}
+
+			if err := wsdl.BuildType(builder, tp); err != nil {
+				return "", err
+			}
+			builder.useType(tp.TypeName())
+			header.TypeName = tp.TypeName()
+			header.Validate = tp.BuildIn == ""
+
+			headers = append(headers, header)
+		}
+	}
+
+	if len(headers) == 0 {
+		return "", nil
+	}
+
+	thisType := "struct {\n"
+	list := ""
+	checks := ""
+	for _, header := range headers {
+		thisType += fmt.Sprintf("%s *%s\n", header.Field, header.TypeName)
+		list += fmt.Sprintf("\t\t{Name: xml.Name{Space: %q, Local: %q}, Value: &h.%s},\n", header.NameSpace, header.Name, header.Field)
+		if header.Validate {
+			builder.Imports["fmt"] = true
+			checks += fmt.Sprintf("\tif h.%[1]s != nil {\n\t\tif err := h.%[1]s.Validate(); err != nil {\n\t\t\treturn fmt.Errorf(\"%[1]s: %%w\", err)\n\t\t}\n\t}\n", header.Field)
+		}
+	}
+	thisType += "}"
+	builder.Types[typeName] = thisType
+
+	builder.Decls[typeName+".soapHeaders"] = fmt.Sprintf(`// soapHeaders lists the header blocks for soap.Envelope, both for encoding and decoding
+func (h *%s) soapHeaders() []soap.Header {
+	if h == nil {
+		return nil
+	}
+	return []soap.Header{
+%s	}
+}`, typeName, list)
+
+	builder.Decls[typeName+".Validate"] = fmt.Sprintf(`// Validate checks the header blocks against the restrictions of the schema
+func (h *%s) Validate() error {
+	if h == nil {
+		return nil
+	}
+%s	return nil
+}`, typeName, checks)
+
+	return typeName, nil
+}
+
+// buildOperationAttachments builds a struct holding the mime:content attachments of the input or output of an
+// operation, with a soapAttachments method listing them for soap.Envelope. It returns the name of the struct, or
+// "" when there are no attachments.
+func (wsdl *WSDL) buildOperationAttachments(builder *Builder, typeName string, messageName string, components []BindingOperationComponent) (string, error) {
+
+	thisType := "struct {\n"
+	list := ""
+	for _, component := range components {
+		if component.In != "content" {
+			continue
+		}
+
+		message, err := wsdl.FindMessage(messageName)
+		if err != nil {
+			return "", err
+		}
+		for _, part := range bodyParts(message, component) {
+			field := makeTypeName(part.Name)
+			thisType += fmt.Sprintf("%s soap.Binary\n", field)
+			list += fmt.Sprintf("\t\t{Part: %q, ContentType: %q, Value: &a.%s},\n", part.Name, component.MimeType, field)
+		}
+	}
+	thisType += "}"
+
+	if list == "" {
+		return "", nil
+	}
+
+	builder.Types[typeName] = thisType
+	builder.Decls[typeName+".soapAttachments"] = fmt.Sprintf(`// soapAttachments lists the attachments for soap.Envelope, both for encoding and decoding
+func (a *%s) soapAttachments() []soap.Attachment {
+	if a == nil {
+		return nil
+	}
+	return []soap.Attachment{
+%s	}
+}`, typeName, list)
+
+	return typeName, nil
+}
+
+// buildOperationBody builds the type sent in the SOAP body for the input or output of an operation
+func (wsdl *WSDL) buildOperationBody(builder *Builder, typePrefix string, op BindingOperation, messageName string, components []BindingOperationComponent, response bool) (body operationBody, err error) {
+
+	if messageName == "" {
+		return body, nil
+	}
+
+	message, err := wsdl.FindMessage(messageName)
+	if err != nil {
+		return body, err
+	}
+
+	var soapBody BindingOperationComponent
+	for _, component := range components {
+		if component.In == "body" {
+			soapBody = component
+		}
+	}
+
+	parts := bodyParts(message, soapBody)
+	if len(soapBody.Parts) == 0 {
+		parts = withoutAttachments(parts, components)
+	}
+
+	if op.Style == StyleRPC {
+		return wsdl.buildRPCWrapper(builder, typePrefix, op, soapBody, parts, response)
+	}
+
+	if len(parts) == 0 {
+		return body, nil
+	}
+	if len(parts) > 1 {
+		return body, errors.Errorf("Document style operation %v has %v body parts, only one is supported", op.Name, len(parts))
+	}
+
+	part := parts[0]
+	var tp ElementType
+	if part.Element != "" {
+		var ok bool
+		tp, ok = wsdl.TypeMap[strings.ToLower(part.Element)]
+		if !ok {
+			return body, errors.Errorf("Could not find element of type %v", part.Element)
+		}
+		body.NameSpace, body.Name = splitFullName(part.Element)
+	} else {
+		var ok bool
+		tp, ok = wsdl.TypeMap[strings.ToLower(part.Type)]
+		if !ok {
+			return body, errors.Errorf("Could not find reference of type %v", part.Type)
+		}
+		body.Name = part.Name
+	}
+
+	if err := wsdl.BuildType(builder, tp); err != nil {
+		return body, err
+	}
+	builder.useType(tp.TypeName())
+	body.TypeName = tp.TypeName()
+
+	wrapperName := op.Name
+	if response {
+		wrapperName += "Response"
+	}
+	if part.Element != "" && body.Name == wrapperName && isWrapper(tp) {
+		if err := wsdl.buildWrapperHelpers(builder, op, tp, response); err != nil {
+			return body, err
+		}
+	}
+
+	return body, nil
+}
+
+// withoutAttachments removes the parts bound to mime:content from the parts of a message
+func withoutAttachments(parts []MessagePart, components []BindingOperationComponent) []MessagePart {
+
+	attachments := make(map[string]bool)
+	for _, component := range components {
+		if component.In == "content" {
+			for _, name := range component.Parts {
+				attachments[name] = true
+			}
+		}
+	}
+
+	var ret []MessagePart
+	for _, part := range parts {
+		if !attachments[part.Name] {
+			ret = append(ret, part)
+		}
+	}
+	return ret
+}
+
+// bodyParts returns the parts of the message put in the SOAP body, limited by the parts attribute of soap:body
+func bodyParts(message Message, soapBody BindingOperationComponent) []MessagePart {
+
+	if len(soapBody.Parts) == 0 {
+		return message.Parts
+	}
+
+	var ret []MessagePart
+	for _, part := range message.Parts {
+		for _, name := range soapBody.Parts {
+			if part.Name == name {
+				ret = append(ret, part)
+			}
+		}
+	}
+	return ret
+}
+
+// buildRPCWrapper builds the operation wrapper element holding the parts of an rpc style message
+func (wsdl *WSDL) buildRPCWrapper(builder *Builder, typePrefix string, op BindingOperation, soapBody BindingOperationComponent, parts []MessagePart, response bool) (body operationBody, err error) {
+
+	body.NameSpace = soapBody.Namespace
+	body.Name = op.Name
+	suffix := "Request"
+	if response {
+		body.Name += "Response"
+		suffix = "Response"
+	}
+	body.TypeName = typePrefix + "_" + suffix
+
+	thisType := "struct {\n"
+	checks := ""
+	for _, part := range parts {
+		// parts referring to a type are unqualified accessors, those referring to an element keep its namespace
+		tpName, elementName := part.Type, part.Name
+		if part.Element != "" {
+			tpName = part.Element
+			space, name := splitFullName(part.Element)
+			elementName = strings.TrimSpace(space + " " + name)
+		}
+
+		tp, ok := wsdl.TypeMap[strings.ToLower(tpName)]
+		if !ok {
+			return body, errors.Errorf("Could not find reference of type %v", tpName)
+		}
+		if err := wsdl.BuildType(builder, tp); err != nil {
+			return body, err
+		}
+		builder.useType(tp.TypeName())
+
+		thisType += fmt.Sprintf("%s %s `xml:\"%s\"`\n", makeTypeName(part.Name), tp.TypeName(), elementName)
+		checks += wsdl.fieldChecks(builder, makeTypeName(part.Name), tp, true)
+	}
+	thisType += "}"
+
+	builder.Types[body.TypeName] = thisType
+	builder.Decls[body.TypeName+".Validate"] = fmt.Sprintf(`// Validate checks the parts against the restrictions of the schema
+func (v %s) Validate() error {
+%sreturn nil
+}`, body.TypeName, checks)
+
+	return body, nil
+}
+
+// isWrapper tells whether the type of an element can be a document/literal wrapper, ie. a plain sequence
+func isWrapper(tp ElementType) bool {
+	return tp.BuildIn == "" && tp.Type == "" && len(tp.ChoiceElements) == 0 && len(tp.AttributeElements) == 0
+}
+
+// buildWrapperHelpers builds a constructor for document/literal wrapped requests and an Unwrap method for responses
+func (wsdl *WSDL) buildWrapperHelpers(builder *Builder, op BindingOperation, tp ElementType, response bool) error {
+
+	var names, params, types, fields []string
+	for _, sub := range tp.SubElements {
+		name, subTp, _, err := wsdl.elementField(sub)
+		if err != nil {
 			return err
 		}
+
+		param := sub.Name
+		if sub.Reference != "" {
+			param = sub.Reference
+		}
+		param = lcFirst(makeTypeName(param))
+		if token.Lookup(param).IsKeyword() {
+			param += "_"
+		}
+
+		names = append(names, name)
+		params = append(params, param)
+		types = append(types, subTp.TypeName())
+		fields = append(fields, "w."+name)
+	}
+
+	typeName := tp.TypeName()
+
+	if response {
+		if len(names) == 0 {
+			return nil
+		}
+		builder.Decls[typeName+".Unwrap"] = fmt.Sprintf(`// Unwrap returns the children of the %s wrapper element
+func (w *%s) Unwrap() (%s) {
+	return %s
+}`, op.Name+"Response", typeName, strings.Join(types, ", "), strings.Join(fields, ", "))
+		return nil
+	}
+
+	funcName := "New" + makeTypeName(op.Name) + "Request"
+	decl := fmt.Sprintf("// %s creates the %s wrapper element from its children\nfunc %s(", funcName, op.Name, funcName)
+	for i := range names {
+		if i > 0 {
+			decl += ", "
+		}
+		decl += params[i] + " " + types[i]
 	}
+	decl += fmt.Sprintf(") *%s {\n\treturn &%s{\n", typeName, typeName)
+	for i := range names {
+		decl += fmt.Sprintf("\t\t%s: %s,\n", names[i], params[i])
+	}
+	decl += "\t}\n}"
+	builder.Decls[funcName] = decl
 
 	return nil
 }
@@ -256,6 +1020,43 @@ func (wsdl *WSDL) FindBinding(name string) (binding Binding, err error) {
 	return binding, errors.Errorf("Binding not found: %s", name)
 }
 
+func (wsdl *WSDL) FindPort(name string) (port Port, err error) {
+
+	_, n := nsSplit(name)
+
+	for _, port := range wsdl.Ports {
+		if port.Name == n {
+			return port, nil
+		}
+	}
+
+	return port, errors.Errorf("Port type not found: %s", name)
+}
+
+func (wsdl *WSDL) FindMessage(name string) (message Message, err error) {
+
+	_, n := nsSplit(name)
+
+	for _, message := range wsdl.Messages {
+		if message.Name == n {
+			return message, nil
+		}
+	}
+
+	return message, errors.Errorf("Message not found: %s", name)
+}
+
+func (port Port) FindOperation(name string) (op PortOperation, err error) {
+
+	for _, op := range port.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+
+	return op, errors.Errorf("Operation %s not found in port type %s", name, port.Name)
+}
+
 func (wsdl *WSDL) GetTargetNamespace() (targetNS, targetNSPrefix string) {
 	return wsdl.TargetNamespace, wsdl.UrlToNameSpaceMapping[wsdl.TargetNamespace]
 }
@@ -269,3 +1070,23 @@ func nsSplit(n string) (ns, name string) {
 
 	return parts[0], parts[1]
 }
+
+// splitFullName splits an expanded "namespace:name" into its parts, the namespace may itself contain colons
+func splitFullName(n string) (ns, name string) {
+
+	i := strings.LastIndex(n, ":")
+	if i < 0 {
+		return "", n
+	}
+
+	return n[:i], n[i+1:]
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,204 @@
+package gowhistler
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+// sourceImporter is shared between tests, so the soap package and its dependencies are only type checked once
+var sourceImporter = importer.ForCompiler(token.NewFileSet(), "source", nil)
+
+// generate parses a WSDL from testdata and type checks the generated package
+func generate(t *testing.T, url string) string {
+	t.Helper()
+
+	wsdl, err := Parse(url)
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, wsdl.Generate(buf, "output"))
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "struct.go", buf.Bytes(), 0)
+	require.NoError(t, err)
+
+	conf := types.Config{Importer: sourceImporter}
+	_, err = conf.Check("output", fset, []*ast.File{file}, nil)
+	require.NoError(t, err, buf.String())
+
+	return buf.String()
+}
+
+func TestGenerateDocumentWrapped(t *testing.T) {
+	src := generate(t, "testdata/wrapped.wsdl")
+
+	require.Contains(t, src, "func NewPersonPortClient(url string, opts ...soap.ClientOption) *PersonPortClient")
+	require.Contains(t, src, "func NewGetPersonRequest(id string, historic bool) *Urn_example_persons__internal_2")
+	require.Contains(t, src, "func (w *Urn_example_persons__internal_3) Unwrap() Urn_example_persons__PersonType")
+	require.Contains(t, src, `Request:  xml.Name{Space: "urn:example:persons", Local: "GetPerson"}`)
+}
+
+func TestGenerateHeaders(t *testing.T) {
+	src := generate(t, "testdata/wrapped.wsdl")
+
+	require.Contains(t, src, "func (c *PersonPortClient) GetPerson(ctx context.Context, request *Urn_example_persons__internal_2, headers *PersonPort_GetPerson_RequestHeaders, opts ...soap.CallOption) (*Urn_example_persons__internal_3, *PersonPort_GetPerson_ResponseHeaders, error)")
+	require.Contains(t, src, "Trace *Urn_example_persons__internal_0")
+	require.Contains(t, src, `{Name: xml.Name{Space: "urn:example:persons", Local: "Trace"}, Value: &h.Trace}`)
+}
+
+func TestGenerateRPC(t *testing.T) {
+	src := generate(t, "testdata/rpc.wsdl")
+
+	require.Contains(t, src, "Symbol string `xml:\"symbol\"`")
+	require.Contains(t, src, "Quote Urn_example_quotes__QuoteType `xml:\"quote\"`")
+	require.Contains(t, src, `Style:    "rpc"`)
+	require.Contains(t, src, `Response: xml.Name{Space: "urn:example:quotes", Local: "GetQuoteResponse"}`)
+	require.NotContains(t, src, "NewGetQuoteRequest")
+	require.Contains(t, src, "Chart  soap.Binary")
+
+	// the local elements of the schema are unqualified
+	require.Contains(t, src, "Symbol string\n")
+	require.NotContains(t, src, "urn:example:quotes Symbol")
+}
+
+func TestGenerateAddressing(t *testing.T) {
+	wsdl, err := Parse("testdata/addressing.wsdl")
+	require.NoError(t, err)
+
+	op, err := wsdl.Ports[0].FindOperation("Echo")
+	require.NoError(t, err)
+	require.Equal(t, "http://example.org/echo/Echo", op.Input.Action)
+	require.True(t, wsdl.Bindings[0].Operations[1].Addressing)
+
+	src := generate(t, "testdata/addressing.wsdl")
+	require.Contains(t, src, `InputAction:  "http://example.org/echo/Echo"`)
+	require.Contains(t, src, `OutputAction: "http://example.org/echo/EchoPortType/EchoResponse"`)
+	require.Contains(t, src, `InputAction:  "http://example.org/echo/EchoPortType/PingIn"`)
+	require.Contains(t, src, `OutputAction: ""`)
+
+	src = generate(t, "testdata/rpc.wsdl")
+	require.NotContains(t, src, "Addressing:")
+}
+
+func TestGenerateAttachments(t *testing.T) {
+	wsdl, err := Parse("testdata/attachments.wsdl")
+	require.NoError(t, err)
+
+	input := wsdl.Bindings[0].Operations[0].Input
+	require.Len(t, input, 2)
+	require.Equal(t, BindingOperationComponent{In: "content", Parts: []string{"photo"}, MimeType: "image/jpeg"}, input[1])
+
+	src := generate(t, "testdata/attachments.wsdl")
+	require.Contains(t, src, "func (c *PhotoPortClient) Upload(ctx context.Context, request *Urn_example_photos__internal_0, attachments *PhotoPort_Upload_RequestAttachments, opts ...soap.CallOption) (*string, *PhotoPort_Upload_ResponseAttachments, error)")
+	require.Contains(t, src, `{Part: "photo", ContentType: "image/jpeg", Value: &a.Photo}`)
+	require.Contains(t, src, `{Part: "thumbnail", ContentType: "image/png", Value: &a.Thumbnail}`)
+	require.Contains(t, src, "Attachments: responseAttachments.soapAttachments()")
+}
+
+func TestGenerateFaults(t *testing.T) {
+	src := generate(t, "testdata/wrapped.wsdl")
+
+	require.Contains(t, src, "type PersonNotFoundFaultError struct")
+	require.Contains(t, src, "Detail *Urn_example_persons__internal_1")
+	require.Contains(t, src, `Detail: xml.Name{Space: "urn:example:persons", Local: "PersonNotFound"}`)
+	require.Contains(t, src, "return &PersonNotFoundFaultError{Fault: fault, Detail: new(Urn_example_persons__internal_1)}")
+	require.Contains(t, src, "return &AccessDeniedFaultError{Fault: fault, Detail: new(string)}")
+}
+
+func TestParseFaults(t *testing.T) {
+	wsdl, err := Parse("testdata/wrapped.wsdl")
+	require.NoError(t, err)
+
+	op, err := wsdl.Ports[0].FindOperation("GetPerson")
+	require.NoError(t, err)
+	require.Equal(t, []PortOperationComponent{
+		{Message: "tns:PersonNotFoundFault", Name: "NotFound"},
+		{Message: "tns:AccessDeniedFault", Name: "AccessDenied"},
+	}, op.Faults)
+	require.Len(t, wsdl.Bindings[0].Operations[0].Fault, 2)
+}
+
+func TestGenerateServer(t *testing.T) {
+	src := generate(t, "testdata/wrapped.wsdl")
+
+	require.Contains(t, src, "GetPerson(ctx context.Context, request *Urn_example_persons__internal_2, headers *PersonPort_GetPerson_RequestHeaders) (*Urn_example_persons__internal_3, *PersonPort_GetPerson_ResponseHeaders, error)")
+	require.Contains(t, src, "func NewPersonPortHandler(server PersonPortServer) *soap.Handler")
+	require.Contains(t, src, "response, responseHeaders, err := server.GetPerson(ctx, request, headers)")
+	require.Contains(t, src, "h.Documents = wsdlDocuments")
+	require.Contains(t, src, `{Location: "testdata/wrapped.wsdl", Content: `)
+	require.Contains(t, src, `{Location: "testdata/common.xsd", Content: `)
+}
+
+func TestGenerateMock(t *testing.T) {
+	src := generate(t, "testdata/wrapped.wsdl")
+
+	require.Contains(t, src, "var _ PersonPortServer = (*PersonPortMock)(nil)")
+	require.Contains(t, src, "GetPersonFunc func(ctx context.Context, request *Urn_example_persons__internal_2, headers *PersonPort_GetPerson_RequestHeaders) (*Urn_example_persons__internal_3, *PersonPort_GetPerson_ResponseHeaders, error)")
+	require.Contains(t, src, "m.getPersonCalls = append(m.getPersonCalls, PersonPort_GetPerson_Call{Request: request, Headers: headers})")
+	require.Contains(t, src, `return nil, nil, &soap.Fault{Code: "soap:Server", String: "PersonPortMock: GetPerson is not mocked"}`)
+	require.Contains(t, src, "func (m *PersonPortMock) ReturnGetPerson(response *Urn_example_persons__internal_3, responseHeaders *PersonPort_GetPerson_ResponseHeaders, err error)")
+	require.Contains(t, src, "func (m *PersonPortMock) GetPersonCalls() []PersonPort_GetPerson_Call")
+
+	src = generate(t, "testdata/rpc.wsdl")
+	require.Contains(t, src, "Mock) Return")
+}
+
+func TestGenerateValidate(t *testing.T) {
+	src := generate(t, "testdata/orders.wsdl")
+
+	require.Contains(t, src, "func (v Urn_example_orders__StatusType) Validate() error")
+	require.Contains(t, src, "case \"open\", \"shipped\":\n\tdefault:\n\t\treturn fmt.Errorf(\"value %q is not one of open, shipped\", v)")
+	require.Contains(t, src, `var urn_example_orders__SkuTypePattern = regexp.MustCompile("^(?:[A-Z]{3}-[0-9]{4})$")`)
+	require.Contains(t, src, "if n := utf8.RuneCountInString(string(v)); n > 200 {")
+	require.Contains(t, src, "if v < 1 {\n\t\treturn fmt.Errorf(\"value %v is below the minimum 1\", v)")
+	require.Contains(t, src, "if v.Placed.IsZero() {\n\t\treturn errors.New(\"Placed is required\")")
+	require.Contains(t, src, "if v.Comment != \"\" {\n\t\tif err := v.Comment.Validate(); err != nil {")
+	require.Contains(t, src, `return fmt.Errorf("Line.%w", err)`)
+	require.Contains(t, src, `return errors.New("exactly one of Email, Phone is required")`)
+	require.Contains(t, src, "if f, err := strconv.ParseFloat(string(v), 64); err == nil && f <= 0 {")
+	require.Contains(t, src, "if _, n, ok := soap.DecimalDigits(string(v)); ok && n > 2 {")
+	require.Contains(t, src, `var urn_example_orders__CodeTypePattern = regexp.MustCompile("^(?:(?:[a-z]+)|(?:[0-9]+))$")`)
+
+	src = generate(t, "testdata/wrapped.wsdl")
+	require.Contains(t, src, "func (h *PersonPort_GetPerson_RequestHeaders) Validate() error")
+	require.Contains(t, src, "if h.Trace != nil {\n\t\tif err := h.Trace.Validate(); err != nil {")
+
+	src = generate(t, "testdata/rpc.wsdl")
+	require.Contains(t, src, "func (v QuotePort_GetQuote_Request) Validate() error")
+}
+
+func TestGenerateListsAndUnions(t *testing.T) {
+	src := generate(t, "testdata/orders.wsdl")
+
+	require.Contains(t, src, "type Urn_example_orders__TagsType []Urn_example_orders__CodeType")
+	require.Contains(t, src, "func (l Urn_example_orders__TagsType) MarshalText() ([]byte, error)")
+	require.Contains(t, src, "for _, field := range strings.Fields(string(text)) {\n\t\tmember := Urn_example_orders__CodeType(field)")
+	require.Contains(t, src, `return fmt.Errorf("item %v: %w", i+1, err)`)
+
+	require.Contains(t, src, "type Urn_example_orders__ReferenceType struct {\n\tInt     *int\n\tMember2 *Urn_example_orders__")
+	require.Contains(t, src, "n, err := strconv.Atoi(value)\n\t\tmember := int(n)\n\t\tif err == nil {\n\t\t\tu.Int = &member")
+	require.Contains(t, src, "if member.Validate() == nil {\n\t\t\tu.Member2 = &member")
+	require.Contains(t, src, `return fmt.Errorf("value %q is not a member of the union", value)`)
+	require.Contains(t, src, "if !reflect.ValueOf(v.Reference).IsZero() {")
+}
+
+func TestGenerateGroups(t *testing.T) {
+	src := generate(t, "testdata/orders.wsdl")
+
+	require.Contains(t, src, "type Urn_example_orders__AddressType struct {\n"+
+		"\tStreet    string  `xml:\"urn:example:orders Street\"`\n"+
+		"\tZip       string  `xml:\"urn:example:orders Zip\"`\n"+
+		"\tCity      string  `xml:\"urn:example:orders City\"`\n"+
+		"\tCountry   string  `xml:\"urn:example:orders Country\"`\n"+
+		"\tEmail     *string `xml:\"urn:example:orders Email\"`\n"+
+		"\tPhone     *string `xml:\"urn:example:orders Phone\"`\n"+
+		"\tCreatedBy string  `xml:\",attr\"`\n"+
+		"\tVersion   int     `xml:\",attr\"`\n}")
+	require.Contains(t, src, "if v.CreatedBy == \"\" {\n\t\treturn errors.New(\"CreatedBy is required\")")
+}
@@ -0,0 +1,280 @@
+// Package c14n implements Canonical XML 1.0 and Exclusive XML Canonicalization 1.0, both without comments,
+// on etree documents.
+package c14n
+
+import (
+	"bytes"
+	"github.com/beevik/etree"
+	"sort"
+	"strings"
+)
+
+// The algorithm identifiers used in ds:CanonicalizationMethod and ds:Transform
+const (
+	InclusiveAlgorithm = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315"
+	ExclusiveAlgorithm = "http://www.w3.org/2001/10/xml-exc-c14n#"
+
+	// ExclusiveNamespace is the namespace of the ec:InclusiveNamespaces element carrying a PrefixList
+	ExclusiveNamespace = "http://www.w3.org/2001/10/xml-exc-c14n#"
+)
+
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// Inclusive returns the canonical form of the subtree rooted at elm. The namespaces and xml: attributes in
+// scope from its ancestors are rendered on elm.
+func Inclusive(elm *etree.Element) []byte {
+	c := &canonicalizer{}
+	c.writeElement(elm, map[string]string{}, true)
+	return c.buf.Bytes()
+}
+
+// Exclusive returns the exclusive canonical form of the subtree rooted at elm. Namespaces are rendered where
+// they are visibly used, except for the prefixes of prefixList that are treated as by Inclusive. The default
+// namespace is named "#default" in the list.
+func Exclusive(elm *etree.Element, prefixList []string) []byte {
+	c := newExclusive(prefixList)
+	c.writeElement(elm, map[string]string{}, true)
+	return c.buf.Bytes()
+}
+
+// InclusiveDocument returns the canonical form of a whole document
+func InclusiveDocument(doc *etree.Document) []byte {
+	c := &canonicalizer{}
+	c.writeDocument(doc)
+	return c.buf.Bytes()
+}
+
+// ExclusiveDocument returns the exclusive canonical form of a whole document
+func ExclusiveDocument(doc *etree.Document, prefixList []string) []byte {
+	c := newExclusive(prefixList)
+	c.writeDocument(doc)
+	return c.buf.Bytes()
+}
+
+// PrefixList splits the PrefixList attribute of an ec:InclusiveNamespaces element
+func PrefixList(list string) []string {
+	return strings.Fields(list)
+}
+
+type canonicalizer struct {
+	exclusive bool
+
+	// inclusive holds the prefixes of the PrefixList, "" being the default namespace
+	inclusive map[string]bool
+
+	buf bytes.Buffer
+}
+
+func newExclusive(prefixList []string) *canonicalizer {
+	c := &canonicalizer{exclusive: true, inclusive: make(map[string]bool)}
+	for _, prefix := range prefixList {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		c.inclusive[prefix] = true
+	}
+	return c
+}
+
+// writeDocument writes the document element and the processing instructions around it, separated by line
+// feeds. The XML declaration, the document type and whitespace outside the document element are dropped.
+func (c *canonicalizer) writeDocument(doc *etree.Document) {
+
+	before := true
+	for _, token := range doc.Child {
+		switch token := token.(type) {
+		case *etree.Element:
+			if !before {
+				c.buf.WriteString("\n")
+			}
+			c.writeElement(token, map[string]string{}, true)
+			before = false
+		case *etree.ProcInst:
+			if token.Target == "xml" {
+				continue
+			}
+			if !before {
+				c.buf.WriteString("\n")
+			}
+			c.writeProcInst(token)
+			if before {
+				c.buf.WriteString("\n")
+			}
+		}
+	}
+}
+
+// writeElement writes elm and its content. rendered holds the namespace declarations in effect from the
+// output ancestors, and apex marks the root of the canonicalized subtree.
+func (c *canonicalizer) writeElement(elm *etree.Element, rendered map[string]string, apex bool) {
+
+	inScope := make(map[string]string, len(rendered))
+	for prefix, uri := range rendered {
+		inScope[prefix] = uri
+	}
+
+	c.buf.WriteString("<" + elm.FullTag())
+	for _, prefix := range c.namespacePrefixes(elm, apex) {
+		uri := lookupNamespace(elm, prefix)
+		if current, ok := rendered[prefix]; ok && current == uri {
+			continue
+		}
+		if uri == "" && (prefix != "" || rendered[""] == "") {
+			continue
+		}
+		inScope[prefix] = uri
+
+		if prefix == "" {
+			c.buf.WriteString(` xmlns="`)
+		} else {
+			c.buf.WriteString(" xmlns:" + prefix + `="`)
+		}
+		escapeAttr(&c.buf, uri)
+		c.buf.WriteString(`"`)
+	}
+
+	attrs := c.attributes(elm, apex)
+	sort.SliceStable(attrs, func(i, j int) bool {
+		ni, nj := attrNamespace(elm, attrs[i]), attrNamespace(elm, attrs[j])
+		if ni != nj {
+			return ni < nj
+		}
+		return attrs[i].Key < attrs[j].Key
+	})
+	for _, attr := range attrs {
+		c.buf.WriteString(" " + attr.FullKey() + `="`)
+		escapeAttr(&c.buf, attr.Value)
+		c.buf.WriteString(`"`)
+	}
+	c.buf.WriteString(">")
+
+	for _, child := range elm.Child {
+		switch child := child.(type) {
+		case *etree.Element:
+			c.writeElement(child, inScope, false)
+		case *etree.CharData:
+			escapeText(&c.buf, child.Data)
+		case *etree.ProcInst:
+			c.writeProcInst(child)
+		}
+	}
+
+	c.buf.WriteString("</" + elm.FullTag() + ">")
+}
+
+func (c *canonicalizer) writeProcInst(pi *etree.ProcInst) {
+	c.buf.WriteString("<?" + pi.Target)
+	if inst := strings.TrimLeft(pi.Inst, " \t\r\n"); inst != "" {
+		c.buf.WriteString(" " + inst)
+	}
+	c.buf.WriteString("?>")
+}
+
+// namespacePrefixes returns the sorted prefixes whose declarations are candidates for rendering on elm. The
+// default namespace "" sorts first.
+func (c *canonicalizer) namespacePrefixes(elm *etree.Element, apex bool) []string {
+
+	candidates := make(map[string]bool)
+	if !c.exclusive || len(c.inclusive) > 0 {
+		// declarations on the element, and at the apex those inherited from its ancestors
+		for e := elm; e != nil; e = e.Parent() {
+			for _, attr := range e.Attr {
+				prefix, ok := declaredPrefix(attr)
+				if ok && (!c.exclusive || c.inclusive[prefix]) {
+					candidates[prefix] = true
+				}
+			}
+			if !apex {
+				break
+			}
+		}
+	}
+	if c.exclusive {
+		// the prefixes visibly utilized by the element and its attributes
+		candidates[elm.Space] = true
+		for _, attr := range elm.Attr {
+			if _, ok := declaredPrefix(attr); !ok && attr.Space != "" {
+				candidates[attr.Space] = true
+			}
+		}
+	}
+	delete(candidates, "xml")
+
+	var prefixes []string
+	for prefix := range candidates {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// attributes returns the attributes of elm other than namespace declarations. Canonical XML also renders the
+// xml: attributes of the ancestors on the apex.
+func (c *canonicalizer) attributes(elm *etree.Element, apex bool) []etree.Attr {
+
+	var attrs []etree.Attr
+	seen := make(map[string]bool)
+	for _, attr := range elm.Attr {
+		if _, ok := declaredPrefix(attr); !ok {
+			attrs = append(attrs, attr)
+			seen[attr.FullKey()] = true
+		}
+	}
+
+	if apex && !c.exclusive {
+		for e := elm.Parent(); e != nil; e = e.Parent() {
+			for _, attr := range e.Attr {
+				if attr.Space == "xml" && !seen[attr.FullKey()] {
+					attrs = append(attrs, attr)
+					seen[attr.FullKey()] = true
+				}
+			}
+		}
+	}
+
+	return attrs
+}
+
+// declaredPrefix returns the prefix declared by a namespace declaration attribute
+func declaredPrefix(attr etree.Attr) (string, bool) {
+	switch {
+	case attr.Space == "xmlns":
+		return attr.Key, true
+	case attr.Space == "" && attr.Key == "xmlns":
+		return "", true
+	}
+	return "", false
+}
+
+// lookupNamespace resolves a prefix in the scope of elm, "" being the default namespace
+func lookupNamespace(elm *etree.Element, prefix string) string {
+	if prefix == "xml" {
+		return xmlNamespace
+	}
+	for e := elm; e != nil; e = e.Parent() {
+		for _, attr := range e.Attr {
+			if declared, ok := declaredPrefix(attr); ok && declared == prefix {
+				return attr.Value
+			}
+		}
+	}
+	return ""
+}
+
+func attrNamespace(elm *etree.Element, attr etree.Attr) string {
+	if attr.Space == "" {
+		return ""
+	}
+	return lookupNamespace(elm, attr.Space)
+}
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+var attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+
+func escapeText(buf *bytes.Buffer, s string) {
+	textEscaper.WriteString(buf, s)
+}
+
+func escapeAttr(buf *bytes.Buffer, s string) {
+	attrEscaper.WriteString(buf, s)
+}
@@ -0,0 +1,150 @@
+package c14n
+
+import (
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func parse(t *testing.T, s string) *etree.Document {
+	t.Helper()
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(s))
+	return doc
+}
+
+// The examples of Canonical XML 1.0 section 3. The parts depending on a DTD are left out, as etree does not
+// process document types.
+func TestInclusiveDocument(t *testing.T) {
+
+	tests := map[string][2]string{
+		"3.1 PIs, comments, and outside of document element": {
+			`<?xml version="1.0"?>` + "\n\n" +
+				`<?xml-stylesheet   href="doc.xsl"` + "\n   " + `type="text/xsl"   ?>` + "\n\n" +
+				`<!DOCTYPE doc SYSTEM "doc.dtd">` + "\n\n" +
+				`<doc>Hello, world!<!-- Comment 1 --></doc>` + "\n\n" +
+				`<?pi-without-data     ?>` + "\n\n" +
+				`<!-- Comment 2 -->` + "\n\n" +
+				`<!-- Comment 3 -->`,
+
+			`<?xml-stylesheet href="doc.xsl"` + "\n   " + `type="text/xsl"   ?>` + "\n" +
+				`<doc>Hello, world!</doc>` + "\n" +
+				`<?pi-without-data?>`,
+		},
+		"3.2 whitespace in document content": {
+			"<doc>\n   <clean>   </clean>\n   <dirty>   A   B   </dirty>\n   <mixed>\n      A\n      <clean>   </clean>\n      B\n      <dirty>   A   B   </dirty>\n      C\n   </mixed>\n</doc>",
+			"<doc>\n   <clean>   </clean>\n   <dirty>   A   B   </dirty>\n   <mixed>\n      A\n      <clean>   </clean>\n      B\n      <dirty>   A   B   </dirty>\n      C\n   </mixed>\n</doc>",
+		},
+		"3.3 start and end tags": {
+			"<doc>\n" +
+				"   <e1   />\n" +
+				"   <e2   ></e2>\n" +
+				`   <e3   name = "elem3"   id="elem3"   />` + "\n" +
+				`   <e4   name="elem4"   id="elem4"   ></e4>` + "\n" +
+				`   <e5 a:attr="out" b:attr="sorted" attr2="all" attr="I'm"` + "\n" +
+				`      xmlns:b="http://www.ietf.org"` + "\n" +
+				`      xmlns:a="http://www.w3.org"` + "\n" +
+				`      xmlns="http://example.org"/>` + "\n" +
+				`   <e6 xmlns="" xmlns:a="http://www.w3.org">` + "\n" +
+				`      <e7 xmlns="http://www.ietf.org">` + "\n" +
+				`         <e8 xmlns="" xmlns:a="http://www.w3.org">` + "\n" +
+				`            <e9 xmlns="" xmlns:a="http://www.ietf.org"/>` + "\n" +
+				"         </e8>\n" +
+				"      </e7>\n" +
+				"   </e6>\n" +
+				"</doc>",
+
+			"<doc>\n" +
+				"   <e1></e1>\n" +
+				"   <e2></e2>\n" +
+				`   <e3 id="elem3" name="elem3"></e3>` + "\n" +
+				`   <e4 id="elem4" name="elem4"></e4>` + "\n" +
+				`   <e5 xmlns="http://example.org" xmlns:a="http://www.w3.org" xmlns:b="http://www.ietf.org" attr="I'm" attr2="all" b:attr="sorted" a:attr="out"></e5>` + "\n" +
+				`   <e6 xmlns:a="http://www.w3.org">` + "\n" +
+				`      <e7 xmlns="http://www.ietf.org">` + "\n" +
+				`         <e8 xmlns="">` + "\n" +
+				`            <e9 xmlns:a="http://www.ietf.org"></e9>` + "\n" +
+				"         </e8>\n" +
+				"      </e7>\n" +
+				"   </e6>\n" +
+				"</doc>",
+		},
+		"3.4 character modifications": {
+			"<doc>\n" +
+				"   <text>First line&#x0d;&#10;Second line</text>\n" +
+				"   <value>&#x32;</value>\n" +
+				`   <compute><![CDATA[value>"0" && value<"10" ?"valid":"error"]]></compute>` + "\n" +
+				`   <compute expr='value>"0" &amp;&amp; value&lt;"10" ?"valid":"error"'>valid</compute>` + "\n" +
+				`   <norm attr=' &apos;   &#x20;&#13;&#xa;&#9;   &apos; '/>` + "\n" +
+				"</doc>",
+
+			"<doc>\n" +
+				"   <text>First line&#xD;\nSecond line</text>\n" +
+				"   <value>2</value>\n" +
+				`   <compute>value&gt;"0" &amp;&amp; value&lt;"10" ?"valid":"error"</compute>` + "\n" +
+				`   <compute expr="value>&quot;0&quot; &amp;&amp; value&lt;&quot;10&quot; ?&quot;valid&quot;:&quot;error&quot;">valid</compute>` + "\n" +
+				`   <norm attr=" '    &#xD;&#xA;&#x9;   ' "></norm>` + "\n" +
+				"</doc>",
+		},
+		"3.6 UTF-8 encoding": {
+			`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<doc>&#169;</doc>`,
+			"<doc>©</doc>",
+		},
+	}
+
+	for name, test := range tests {
+		require.Equal(t, test[1], string(InclusiveDocument(parse(t, test[0]))), name)
+	}
+}
+
+// The examples of Exclusive XML Canonicalization 1.0 section 2.2, canonicalizing the n1:elem2 subtree
+func TestExclusive(t *testing.T) {
+
+	first := parse(t, `<n0:local xmlns:n0="foo:bar" xmlns:n3="ftp://example.org">`+"\n"+
+		`  <n1:elem2 xmlns:n1="http://example.net" xml:lang="en">`+"\n"+
+		`    <n3:stuff xmlns:n3="ftp://example.org"/>`+"\n"+
+		`  </n1:elem2>`+"\n"+
+		`</n0:local>`)
+	second := parse(t, `<n2:pdu xmlns:n1="http://example.com" xmlns:n2="http://foo.example" xml:lang="fr" xml:space="retain">`+"\n"+
+		`  <n1:elem2 xmlns:n1="http://example.net" xml:lang="en">`+"\n"+
+		`    <n3:stuff xmlns:n3="ftp://example.org"/>`+"\n"+
+		`  </n1:elem2>`+"\n"+
+		`</n2:pdu>`)
+
+	require.Equal(t,
+		`<n1:elem2 xmlns:n0="foo:bar" xmlns:n1="http://example.net" xmlns:n3="ftp://example.org" xml:lang="en">`+"\n"+
+			`    <n3:stuff></n3:stuff>`+"\n"+
+			`  </n1:elem2>`,
+		string(Inclusive(first.FindElement("//elem2"))))
+	require.Equal(t,
+		`<n1:elem2 xmlns:n1="http://example.net" xmlns:n2="http://foo.example" xml:lang="en" xml:space="retain">`+"\n"+
+			`    <n3:stuff xmlns:n3="ftp://example.org"></n3:stuff>`+"\n"+
+			`  </n1:elem2>`,
+		string(Inclusive(second.FindElement("//elem2"))))
+
+	exclusive := `<n1:elem2 xmlns:n1="http://example.net" xml:lang="en">` + "\n" +
+		`    <n3:stuff xmlns:n3="ftp://example.org"></n3:stuff>` + "\n" +
+		`  </n1:elem2>`
+	require.Equal(t, exclusive, string(Exclusive(first.FindElement("//elem2"), nil)))
+	require.Equal(t, exclusive, string(Exclusive(second.FindElement("//elem2"), nil)))
+
+	// prefixes of the PrefixList are rendered as by inclusive canonicalization
+	require.Equal(t,
+		`<n1:elem2 xmlns:n1="http://example.net" xmlns:n2="http://foo.example" xml:lang="en">`+"\n"+
+			`    <n3:stuff xmlns:n3="ftp://example.org"></n3:stuff>`+"\n"+
+			`  </n1:elem2>`,
+		string(Exclusive(second.FindElement("//elem2"), PrefixList("n2 n3"))))
+}
+
+func TestExclusiveDefaultNamespace(t *testing.T) {
+
+	doc := parse(t, `<a:root xmlns:a="urn:a" xmlns:b="urn:b" xmlns="urn:default">`+
+		`<a:child b:attr="1" z="&quot;2&quot;" a:attr="3"><b:empty/><plain>x &amp; y</plain></a:child></a:root>`)
+
+	require.Equal(t,
+		`<a:child xmlns:a="urn:a" xmlns:b="urn:b" z="&quot;2&quot;" a:attr="3" b:attr="1"><b:empty></b:empty><plain xmlns="urn:default">x &amp; y</plain></a:child>`,
+		string(Exclusive(doc.FindElement("//child"), nil)))
+	require.Equal(t,
+		`<a:child xmlns="urn:default" xmlns:a="urn:a" xmlns:b="urn:b" z="&quot;2&quot;" a:attr="3" b:attr="1"><b:empty></b:empty><plain>x &amp; y</plain></a:child>`,
+		string(Exclusive(doc.FindElement("//child"), PrefixList("#default"))))
+}
@@ -0,0 +1,327 @@
+// Package dgws adds the headers of the Danish health services (DGWS 1.0.1) to SOAP requests: the Medcom
+// header linking the messages of a flow, and an ID card as a SAML 2.0 assertion in the security header.
+package dgws
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/beevik/etree"
+	"github.com/keanpedersen/gowhistler/c14n"
+	"github.com/keanpedersen/gowhistler/soap"
+	"github.com/pkg/errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The namespaces of the DGWS headers
+const (
+	SAMLNamespace   = "urn:oasis:names:tc:SAML:2.0:assertion"
+	MedcomNamespace = "http://www.medcom.dk/dgws/2006/04/dgws-1.0.xsd"
+	SOSINamespace   = "http://www.sosi.dk/sosi/2006/04/sosi-1.0.xsd"
+)
+
+// The algorithms of the ID card signature, DGWS 1.0.1 signs with SHA-1
+const (
+	EnvelopedSignature = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	RSASHA1            = "http://www.w3.org/2000/09/xmldsig#rsa-sha1"
+	SHA1               = "http://www.w3.org/2000/09/xmldsig#sha1"
+)
+
+// Priorities of the Medcom header
+const (
+	PriorityAcute   = "AKUT"
+	PriorityHigh    = "HASTER"
+	PriorityRoutine = "RUTINE"
+)
+
+// DefaultIDCardValidity is how long a self signed ID card is valid, the maximum allowed by DGWS
+const DefaultIDCardValidity = 24 * time.Hour
+
+// Card is the source of the ID card attached to requests
+type Card interface {
+	// Assertion returns the saml:Assertion of the ID card, a copy the caller may insert in an envelope
+	Assertion() (*etree.Element, error)
+}
+
+// IDCard is a system ID card issued and signed by the calling system itself with its VOCES certificate
+type IDCard struct {
+	// ITSystemName names the calling system
+	ITSystemName string
+
+	// CareProviderID identifies the organisation, a CVR number unless CareProviderIDFormat says otherwise
+	CareProviderID       string
+	CareProviderIDFormat string
+	CareProviderName     string
+
+	// AuthenticationLevel of the card, 3 for a system card if zero
+	AuthenticationLevel int
+
+	// Key and Certificate sign the card
+	Key         crypto.Signer
+	Certificate *x509.Certificate
+
+	// Validity is how long a card is used before a new one is signed, DefaultIDCardValidity if zero
+	Validity time.Duration
+
+	// Now returns the issue time of cards, time.Now if nil
+	Now func() time.Time
+
+	mutex     sync.Mutex
+	assertion *etree.Element
+	expires   time.Time
+}
+
+// Assertion returns the signed card, signing a new one when the previous has expired
+func (c *IDCard) Assertion() (*etree.Element, error) {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now
+	if c.Now != nil {
+		now = c.Now
+	}
+	issued := now().UTC().Truncate(time.Second)
+
+	if c.assertion == nil || !issued.Before(c.expires) {
+		validity := c.Validity
+		if validity == 0 {
+			validity = DefaultIDCardValidity
+		}
+
+		assertion, err := c.sign(issued, issued.Add(validity))
+		if err != nil {
+			return nil, err
+		}
+		c.assertion, c.expires = assertion, issued.Add(validity)
+	}
+
+	return c.assertion.Copy(), nil
+}
+
+func (c *IDCard) sign(issued, expires time.Time) (*etree.Element, error) {
+
+	if c.Key == nil || c.Certificate == nil {
+		return nil, errors.New("dgws: ID card needs a key and a certificate")
+	}
+
+	cvrFormat := c.CareProviderIDFormat
+	if cvrFormat == "" {
+		cvrFormat = "medcom:cvrnumber"
+	}
+	level := c.AuthenticationLevel
+	if level == 0 {
+		level = 3
+	}
+	cardID, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	certHash := sha1.Sum(c.Certificate.Raw)
+
+	assertion := etree.NewElement("saml:Assertion")
+	assertion.CreateAttr("xmlns:saml", SAMLNamespace)
+	assertion.CreateAttr("xmlns:ds", soap.DSigNamespace)
+	assertion.CreateAttr("xmlns:medcom", MedcomNamespace)
+	assertion.CreateAttr("xmlns:sosi", SOSINamespace)
+	assertion.CreateAttr("IssueInstant", issued.Format(time.RFC3339))
+	assertion.CreateAttr("Version", "2.0")
+	assertion.CreateAttr("id", "IDCard")
+
+	assertion.CreateElement("saml:Issuer").SetText(c.ITSystemName)
+
+	subject := assertion.CreateElement("saml:Subject")
+	nameID := subject.CreateElement("saml:NameID")
+	nameID.CreateAttr("Format", cvrFormat)
+	nameID.SetText(c.CareProviderID)
+	confirmation := subject.CreateElement("saml:SubjectConfirmation")
+	confirmation.CreateElement("saml:ConfirmationMethod").SetText("urn:oasis:names:tc:SAML:2.0:cm:holder-of-key")
+	confirmation.CreateElement("saml:SubjectConfirmationData").CreateElement("ds:KeyInfo").CreateElement("ds:KeyName").SetText("OCESSignature")
+
+	conditions := assertion.CreateElement("saml:Conditions")
+	conditions.CreateAttr("NotBefore", issued.Format(time.RFC3339))
+	conditions.CreateAttr("NotOnOrAfter", expires.Format(time.RFC3339))
+
+	cardData := assertion.CreateElement("saml:AttributeStatement")
+	cardData.CreateAttr("id", "IDCardData")
+	addAttribute(cardData, "sosi:IDCardID", "", cardID)
+	addAttribute(cardData, "sosi:IDCardVersion", "", "1.0.1")
+	addAttribute(cardData, "sosi:IDCardType", "", "system")
+	addAttribute(cardData, "sosi:AuthenticationLevel", "", strconv.Itoa(level))
+	addAttribute(cardData, "sosi:OCESCertHash", "", base64.StdEncoding.EncodeToString(certHash[:]))
+
+	systemLog := assertion.CreateElement("saml:AttributeStatement")
+	systemLog.CreateAttr("id", "SystemLog")
+	addAttribute(systemLog, "medcom:ITSystemName", "", c.ITSystemName)
+	addAttribute(systemLog, "medcom:CareProviderID", cvrFormat, c.CareProviderID)
+	addAttribute(systemLog, "medcom:CareProviderName", "", c.CareProviderName)
+
+	// the enveloped signature covers the assertion as it is before the signature is added
+	digest := sha1.Sum(c14n.Exclusive(assertion, nil))
+
+	signature := assertion.CreateElement("ds:Signature")
+	signature.CreateAttr("id", "OCESSignature")
+	signedInfo := signature.CreateElement("ds:SignedInfo")
+	signedInfo.CreateElement("ds:CanonicalizationMethod").CreateAttr("Algorithm", c14n.ExclusiveAlgorithm)
+	signedInfo.CreateElement("ds:SignatureMethod").CreateAttr("Algorithm", RSASHA1)
+	reference := signedInfo.CreateElement("ds:Reference")
+	reference.CreateAttr("URI", "#IDCard")
+	transforms := reference.CreateElement("ds:Transforms")
+	transforms.CreateElement("ds:Transform").CreateAttr("Algorithm", EnvelopedSignature)
+	transforms.CreateElement("ds:Transform").CreateAttr("Algorithm", c14n.ExclusiveAlgorithm)
+	reference.CreateElement("ds:DigestMethod").CreateAttr("Algorithm", SHA1)
+	reference.CreateElement("ds:DigestValue").SetText(base64.StdEncoding.EncodeToString(digest[:]))
+
+	signedDigest := sha1.Sum(c14n.Exclusive(signedInfo, nil))
+	value, err := c.Key.Sign(rand.Reader, signedDigest[:], crypto.SHA1)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	signature.CreateElement("ds:SignatureValue").SetText(base64.StdEncoding.EncodeToString(value))
+	signature.CreateElement("ds:KeyInfo").CreateElement("ds:X509Data").CreateElement("ds:X509Certificate").
+		SetText(base64.StdEncoding.EncodeToString(c.Certificate.Raw))
+
+	return assertion, nil
+}
+
+func addAttribute(statement *etree.Element, name, nameFormat, value string) {
+	attribute := statement.CreateElement("saml:Attribute")
+	attribute.CreateAttr("Name", name)
+	if nameFormat != "" {
+		attribute.CreateAttr("NameFormat", nameFormat)
+	}
+	attribute.CreateElement("saml:AttributeValue").SetText(value)
+}
+
+// IssuedCard is an ID card issued by an STS, attached to requests as it is
+type IssuedCard struct {
+	Element *etree.Element
+}
+
+// ParseIssuedCard finds the saml:Assertion in an XML document, eg. the response of an STS
+func ParseIssuedCard(data []byte) (*IssuedCard, error) {
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, elm := range doc.FindElements("//Assertion") {
+		if elm.NamespaceURI() != SAMLNamespace {
+			continue
+		}
+
+		// the namespaces declared by the enclosing elements move onto the assertion
+		assertion := elm.Copy()
+		declared := make(map[string]bool)
+		for e := elm; e != nil; e = e.Parent() {
+			for _, attr := range e.Attr {
+				if (attr.Space == "xmlns" || (attr.Space == "" && attr.Key == "xmlns")) && !declared[attr.FullKey()] {
+					declared[attr.FullKey()] = true
+					if e != elm {
+						assertion.CreateAttr(attr.FullKey(), attr.Value)
+					}
+				}
+			}
+		}
+		return &IssuedCard{Element: assertion}, nil
+	}
+	return nil, errors.New("dgws: no saml:Assertion found")
+}
+
+func (c *IssuedCard) Assertion() (*etree.Element, error) {
+	if c.Element == nil {
+		return nil, errors.New("dgws: issued card has no assertion")
+	}
+	return c.Element.Copy(), nil
+}
+
+// Header is a soap.EnvelopeHandler adding the ID card to the security header of every request, and a
+// medcom:Header identifying the message
+type Header struct {
+	Card Card
+
+	// SecurityLevel of the messages, 3 if zero
+	SecurityLevel int
+
+	// Priority of the messages, PriorityRoutine if empty
+	Priority string
+
+	// FlowID links the messages of a flow, every message starting its own flow if empty
+	FlowID string
+
+	// Now returns the creation time of the security header timestamp, time.Now if nil
+	Now func() time.Time
+}
+
+func (h *Header) HandleRequest(op soap.Operation, envelope *etree.Document) error {
+
+	if h.Card == nil {
+		return errors.New("dgws: header needs a card")
+	}
+
+	assertion, err := h.Card.Assertion()
+	if err != nil {
+		return err
+	}
+
+	security, err := soap.SecurityHeader(envelope)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now
+	if h.Now != nil {
+		now = h.Now
+	}
+	timestamp := etree.NewElement("wsu:Timestamp")
+	timestamp.CreateElement("wsu:Created").SetText(now().UTC().Format(time.RFC3339))
+	security.InsertChildAt(0, timestamp)
+	security.AddChild(assertion)
+
+	level := h.SecurityLevel
+	if level == 0 {
+		level = 3
+	}
+	priority := h.Priority
+	if priority == "" {
+		priority = PriorityRoutine
+	}
+	messageID, err := newID()
+	if err != nil {
+		return err
+	}
+	flowID := h.FlowID
+	if flowID == "" {
+		if flowID, err = newID(); err != nil {
+			return err
+		}
+	}
+
+	header, err := soap.EnvelopeHeader(envelope)
+	if err != nil {
+		return err
+	}
+	medcom := header.CreateElement("medcom:Header")
+	medcom.CreateAttr("xmlns:medcom", MedcomNamespace)
+	medcom.CreateElement("medcom:SecurityLevel").SetText(strconv.Itoa(level))
+	linking := medcom.CreateElement("medcom:Linking")
+	linking.CreateElement("medcom:FlowID").SetText(flowID)
+	linking.CreateElement("medcom:MessageID").SetText(messageID)
+	medcom.CreateElement("medcom:Priority").SetText(priority)
+
+	return nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,151 @@
+package dgws
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"github.com/beevik/etree"
+	"github.com/keanpedersen/gowhistler/c14n"
+	"github.com/keanpedersen/gowhistler/soap"
+	"github.com/stretchr/testify/require"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type getPerson struct {
+	XMLName xml.Name `xml:"urn:example:cpr getPerson"`
+	CPR     string   `xml:"cpr"`
+}
+
+func testCertificate(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "system"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return key, cert
+}
+
+// send calls a test server with the header handler, returning the envelope it received
+func send(t *testing.T, header *Header) *etree.Document {
+	t.Helper()
+
+	doc := etree.NewDocument()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, doc.ReadFromBytes(body))
+		io.WriteString(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body/></soap:Envelope>`)
+	}))
+	defer server.Close()
+
+	client := soap.NewClient(server.URL)
+	client.EnvelopeHandlers = []soap.EnvelopeHandler{header}
+	op := soap.Operation{Name: "getPerson", Request: xml.Name{Space: "urn:example:cpr", Local: "getPerson"}}
+	require.NoError(t, client.Call(context.Background(), op, &soap.Envelope{Body: &getPerson{CPR: "0101010000"}}, &soap.Envelope{}))
+
+	return doc
+}
+
+func TestIDCard(t *testing.T) {
+
+	key, cert := testCertificate(t)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	card := &IDCard{
+		ITSystemName:     "Gowhistler",
+		CareProviderID:   "12345678",
+		CareProviderName: "Test Provider",
+		Key:              key,
+		Certificate:      cert,
+		Now:              func() time.Time { return now },
+	}
+
+	doc := send(t, &Header{Card: card, FlowID: "flow-1"})
+
+	require.NotNil(t, doc.FindElement("//Header/Security/Timestamp/Created"))
+	require.Equal(t, "3", doc.FindElement("//Header/Header/SecurityLevel").Text())
+	require.Equal(t, "flow-1", doc.FindElement("//Header/Header/Linking/FlowID").Text())
+	require.NotEmpty(t, doc.FindElement("//Header/Header/Linking/MessageID").Text())
+	require.Equal(t, PriorityRoutine, doc.FindElement("//Header/Header/Priority").Text())
+
+	assertion := doc.FindElement("//Header/Security/Assertion")
+	require.Equal(t, SAMLNamespace, assertion.NamespaceURI())
+	require.Equal(t, "2024-05-02T12:00:00Z", assertion.FindElement("Conditions").SelectAttrValue("NotOnOrAfter", ""))
+	require.Equal(t, "12345678", assertion.FindElement("Subject/NameID").Text())
+	require.Equal(t, "system", assertion.FindElement("AttributeStatement/Attribute[@Name='sosi:IDCardType']/AttributeValue").Text())
+
+	// the enveloped signature verifies with the card certificate
+	signature := assertion.SelectElement("Signature")
+	signedInfo := signature.SelectElement("SignedInfo")
+	value, err := base64.StdEncoding.DecodeString(signature.SelectElement("SignatureValue").Text())
+	require.NoError(t, err)
+	digest := sha1.Sum(c14n.Exclusive(signedInfo, nil))
+	require.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], value))
+
+	assertion.RemoveChild(signature)
+	digest = sha1.Sum(c14n.Exclusive(assertion, nil))
+	require.Equal(t, base64.StdEncoding.EncodeToString(digest[:]), signedInfo.FindElement("Reference/DigestValue").Text())
+
+	// cards are reused until they expire
+	cardID := func() string {
+		assertion, err := card.Assertion()
+		require.NoError(t, err)
+		return assertion.FindElement("AttributeStatement/Attribute[@Name='sosi:IDCardID']/AttributeValue").Text()
+	}
+	first := cardID()
+	require.Equal(t, first, cardID())
+	now = now.Add(DefaultIDCardValidity)
+	require.NotEqual(t, first, cardID())
+}
+
+func TestIssuedCard(t *testing.T) {
+
+	card, err := ParseIssuedCard([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">` +
+		`<soap:Body><saml:Assertion id="IDCard"><saml:Issuer>TESTSTS</saml:Issuer></saml:Assertion></soap:Body></soap:Envelope>`))
+	require.NoError(t, err)
+
+	doc := send(t, &Header{Card: card})
+	assertion := doc.FindElement("//Header/Security/Assertion")
+	require.Equal(t, SAMLNamespace, assertion.NamespaceURI())
+	require.Equal(t, "TESTSTS", assertion.FindElement("Issuer").Text())
+	require.NotEqual(t, "", doc.FindElement("//Header/Header/Linking/FlowID").Text())
+
+	_, err = ParseIssuedCard([]byte(`<Envelope/>`))
+	require.Error(t, err)
+}
+
+func TestMissingCard(t *testing.T) {
+
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body/></soap:Envelope>`))
+
+	for name, header := range map[string]*Header{
+		"no card":        {},
+		"no key":         {Card: &IDCard{ITSystemName: "Gowhistler"}},
+		"no certificate": {Card: &IDCard{Key: &rsa.PrivateKey{}}},
+		"no assertion":   {Card: &IssuedCard{}},
+	} {
+		require.Error(t, header.HandleRequest(soap.Operation{}, doc), name)
+	}
+}
@@ -18,6 +18,15 @@ func init() {
 	}
 }
 
+// Document is a WSDL or schema document loaded while parsing
+type Document struct {
+	Location string // as given in the WSDL or schemaLocation referencing it
+	Doc      *etree.Document
+}
+
+// loaded holds every document read by getWSDL since the last Parse
+var loaded []Document
+
 func getWSDL(url string) (doc *etree.Document, err error) {
 
 	var raw io.ReadCloser
@@ -86,6 +95,14 @@ func getWSDL(url string) (doc *etree.Document, err error) {
 		return nil, errors.WithStack(err)
 	}
 
+	found := false
+	for _, document := range loaded {
+		found = found || document.Location == url
+	}
+	if !found {
+		loaded = append(loaded, Document{Location: url, Doc: doc})
+	}
+
 	return doc, nil
 }
 
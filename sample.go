@@ -0,0 +1,522 @@
+package gowhistler
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/beevik/etree"
+	"github.com/keanpedersen/gowhistler/soap"
+	"github.com/pkg/errors"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+)
+
+// sampler builds example instances of the schema types, filling the required elements, the first branch
+// of choices and the first value of enumerations
+type sampler struct {
+	wsdl *WSDL
+
+	// types being filled further up the tree, recursive types are cut short
+	filling map[string]bool
+}
+
+func newSampler(wsdl *WSDL) *sampler {
+	return &sampler{wsdl: wsdl, filling: make(map[string]bool)}
+}
+
+// SampleElement returns an example of the global element given as "namespace:name", eg. the element of a
+// message part
+func (wsdl *WSDL) SampleElement(name string) (*etree.Element, error) {
+
+	typeRef, err := wsdl.elementTypeRef(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ns, local := splitFullName(name)
+	elm := etree.NewElement(local)
+	elm.CreateAttr("xmlns", ns)
+	if err := newSampler(wsdl).content(elm, typeRef); err != nil {
+		return nil, err
+	}
+	return elm, nil
+}
+
+// SampleEnvelope returns an example SOAP envelope of the request, or the response, of a binding operation,
+// with the soap:header blocks and the body of the binding. Attachments are not included.
+func (wsdl *WSDL) SampleEnvelope(binding Binding, op BindingOperation, response bool) (*etree.Document, error) {
+
+	portType, err := wsdl.FindPort(binding.Type)
+	if err != nil {
+		return nil, err
+	}
+	portOp, err := portType.FindOperation(op.Name)
+	if err != nil {
+		return nil, err
+	}
+	messageName, components, wrapperName := portOp.Input.Message, op.Input, op.Name
+	if response {
+		messageName, components, wrapperName = portOp.Output.Message, op.Output, op.Name+"Response"
+	}
+
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	envelope := doc.CreateElement("soap:Envelope")
+	envelope.CreateAttr("xmlns:soap", soap.EnvelopeNamespace)
+
+	s := newSampler(wsdl)
+	var header *etree.Element
+	var soapBody BindingOperationComponent
+	for _, component := range components {
+		switch component.In {
+		case "body":
+			soapBody = component
+		case "header":
+			message, err := wsdl.FindMessage(component.Message)
+			if err != nil {
+				return nil, err
+			}
+			if header == nil {
+				header = envelope.CreateElement("soap:Header")
+			}
+			for _, part := range bodyParts(message, component) {
+				if err := s.part(header, part); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	body := envelope.CreateElement("soap:Body")
+	if messageName == "" {
+		return doc, nil
+	}
+	message, err := wsdl.FindMessage(messageName)
+	if err != nil {
+		return nil, err
+	}
+	parts := bodyParts(message, soapBody)
+	if len(soapBody.Parts) == 0 {
+		parts = withoutAttachments(parts, components)
+	}
+
+	if op.Style == StyleRPC {
+		body = body.CreateElement(wrapperName)
+		body.CreateAttr("xmlns", soapBody.Namespace)
+	}
+	for _, part := range parts {
+		if err := s.part(body, part); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+// WriteSamples writes an example of every message part and of the request and response envelopes of every
+// binding operation to dir, as files named like the generated variables and operations
+func (wsdl *WSDL) WriteSamples(dir string) error {
+
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return errors.WithStack(err)
+	}
+
+	s := newSampler(wsdl)
+	for _, message := range wsdl.Messages {
+		for _, part := range message.Parts {
+			doc := etree.NewDocument()
+			doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+			if err := s.part(&doc.Element, part); err != nil {
+				return err
+			}
+			if err := writeSample(doc, dir, ucFirst(message.Name+"_"+part.Name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, binding := range wsdl.Bindings {
+		for _, op := range binding.Operations {
+			name := makeTypeName(binding.Name) + "_" + makeTypeName(op.Name)
+			for _, response := range []bool{false, true} {
+				doc, err := wsdl.SampleEnvelope(binding, op, response)
+				if err != nil {
+					return err
+				}
+				suffix := "_Request"
+				if response {
+					suffix = "_Response"
+				}
+				if err := writeSample(doc, dir, name+suffix); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeSample(doc *etree.Document, dir, name string) error {
+	doc.Indent(2)
+	if err := doc.WriteToFile(filepath.Join(dir, name+".xml")); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// part adds an example of a message part to parent, its element or an unqualified element named by the part
+func (s *sampler) part(parent *etree.Element, part MessagePart) error {
+
+	if part.Element == "" {
+		return s.element(parent, "", part.Name, part.Type)
+	}
+
+	typeRef, err := s.wsdl.elementTypeRef(part.Element)
+	if err != nil {
+		return err
+	}
+	ns, name := splitFullName(part.Element)
+	return s.element(parent, ns, name, typeRef)
+}
+
+// element adds an example element of the given namespace, name and type to parent
+func (s *sampler) element(parent *etree.Element, ns, name, typeRef string) error {
+
+	elm := parent.CreateElement(name)
+	if elm.NamespaceURI() != ns {
+		elm.CreateAttr("xmlns", ns)
+	}
+	return s.content(elm, typeRef)
+}
+
+// content fills elm with the attributes and content of an example of the referenced type
+func (s *sampler) content(elm *etree.Element, typeRef string) error {
+
+	tp, ok := s.wsdl.TypeMap[strings.ToLower(typeRef)]
+	if !ok {
+		return errors.Errorf("Could not find reference of type %v", typeRef)
+	}
+
+	if len(tp.Enum) > 0 {
+		elm.SetText(tp.Enum[0])
+		return nil
+	}
+	for _, pattern := range tp.Patterns {
+		if value, ok := patternValue(pattern); ok {
+			elm.SetText(value)
+			return nil
+		}
+	}
+	if tp.BuildIn != "" {
+		elm.SetText(sampleValue(typeRef))
+		return nil
+	}
+	if tp.ListItem != "" {
+		// a single item
+		return s.content(elm, tp.ListItem)
+	}
+	if len(tp.UnionMembers) > 0 {
+		return s.content(elm, tp.UnionMembers[0])
+	}
+
+	key := strings.ToLower(tp.FullName())
+	if s.filling[key] {
+		return nil
+	}
+	s.filling[key] = true
+	defer delete(s.filling, key)
+
+	for _, name := range sortedKeys(tp.AttributeElements) {
+		value := etree.NewElement(name)
+		if err := s.content(value, tp.AttributeElements[name]); err != nil {
+			return err
+		}
+		elm.CreateAttr(name, value.Text())
+	}
+
+	for _, sub := range tp.SubElements {
+		for i := 0; i < sub.MinOccurs; i++ {
+			if err := s.subElement(elm, sub); err != nil {
+				return err
+			}
+		}
+	}
+	if len(tp.ChoiceElements) > 0 {
+		if err := s.subElement(elm, tp.ChoiceElements[0]); err != nil {
+			return err
+		}
+	}
+
+	if len(tp.SubElements) == 0 && len(tp.ChoiceElements) == 0 && tp.Type != "" {
+		if err := s.content(elm, tp.Type); err != nil {
+			return err
+		}
+		builtIn, _ := s.wsdl.restrictionBase(typeRef)
+		if value := facetValue(elm.Text(), tp, builtIn); value != elm.Text() {
+			elm.SetText(value)
+		}
+	}
+	return nil
+}
+
+// subElement adds an example of a local element or element reference of a complex type to parent
+func (s *sampler) subElement(parent *etree.Element, sub Element) error {
+
+	ns, name, typeRef, err := s.wsdl.subElementName(sub)
+	if err != nil {
+		return err
+	}
+	return s.element(parent, ns, name, typeRef)
+}
+
+// subElementName returns the namespace, name and type of a local element or element reference
+func (wsdl *WSDL) subElementName(sub Element) (ns, name, typeRef string, err error) {
+
+	if sub.Reference != "" {
+		typeRef, err := wsdl.elementTypeRef(sub.ReferenceNameSpace + ":" + sub.Reference)
+		return sub.ReferenceNameSpace, sub.Reference, typeRef, err
+	}
+
+	typeRef = sub.ElementType
+	if !strings.Contains(typeRef, ":") {
+		typeRef = sub.NameSpace + ":" + typeRef
+	}
+	ns = sub.NameSpace
+	if sub.Unqualified {
+		ns = ""
+	}
+	return ns, sub.Name, typeRef, nil
+}
+
+// elementTypeRef returns the type of a global element given as "namespace:name"
+func (wsdl *WSDL) elementTypeRef(name string) (string, error) {
+
+	for _, elm := range wsdl.Elements {
+		ns := elm.NameSpace
+		if ns == "" {
+			ns = wsdl.TargetNamespace
+		}
+		if !strings.EqualFold(ns+":"+elm.Name, name) {
+			continue
+		}
+		if !strings.Contains(elm.ElementType, ":") {
+			return wsdl.TargetNamespace + ":" + elm.ElementType, nil
+		}
+		return elm.ElementType, nil
+	}
+
+	return "", errors.Errorf("Could not find element %v", name)
+}
+
+// sampleValue returns a valid value of a built in schema type
+func sampleValue(typeRef string) string {
+
+	_, name := splitFullName(typeRef)
+	switch strings.ToLower(name) {
+	case "boolean":
+		return "true"
+	case "int", "integer", "long", "short", "byte", "decimal", "positiveinteger", "nonnegativeinteger",
+		"unsignedint", "unsignedlong", "unsignedshort", "unsignedbyte":
+		return "1"
+	case "float", "double":
+		return "1.5"
+	case "date":
+		return "2024-01-31"
+	case "datetime":
+		return "2024-01-31T12:00:00Z"
+	case "time":
+		return "12:00:00"
+	case "duration":
+		return "P1D"
+	case "base64binary":
+		return "c2FtcGxl"
+	case "hexbinary":
+		return "73616d706c65"
+	case "anyuri":
+		return "http://example.com/"
+	default:
+		return "string"
+	}
+}
+
+// facetValue adjusts a sample value of the base type of a restriction to its length, bound and digits facets.
+// Lengths count the items of lists and the octets of binary types.
+func facetValue(value string, tp ElementType, builtIn string) string {
+
+	switch builtIn {
+	case "list":
+		items := strings.Fields(value)
+		n := facetLength(len(items), tp)
+		for len(items) > 0 && len(items) < n {
+			items = append(items, items[0])
+		}
+		if len(items) > n {
+			items = items[:n]
+		}
+		return strings.Join(items, " ")
+	case "base64binary", "hexbinary":
+		decode, encode := base64.StdEncoding.DecodeString, base64.StdEncoding.EncodeToString
+		if builtIn == "hexbinary" {
+			decode, encode = hex.DecodeString, hex.EncodeToString
+		}
+		data, err := decode(value)
+		if err != nil {
+			return value
+		}
+		n := facetLength(len(data), tp)
+		for len(data) < n {
+			data = append(data, 'x')
+		}
+		return encode(data[:n])
+	case "int", "integer", "long", "short", "byte", "positiveinteger", "nonnegativeinteger", "unsignedint",
+		"unsignedlong", "unsignedshort", "unsignedbyte":
+		return boundedValue(value, tp, true)
+	case "decimal", "float", "double":
+		return boundedValue(value, tp, false)
+	case "boolean", "date", "datetime", "time", "duration":
+		return value
+	}
+
+	runes := []rune(value)
+	n := facetLength(len(runes), tp)
+	for len(runes) < n {
+		runes = append(runes, 'x')
+	}
+	return string(runes[:n])
+}
+
+// facetLength returns the length closest to n allowed by the length facets
+func facetLength(n int, tp ElementType) int {
+	if length, err := strconv.Atoi(tp.Length); err == nil {
+		return length
+	}
+	if minLength, err := strconv.Atoi(tp.MinLength); err == nil && n < minLength {
+		n = minLength
+	}
+	if maxLength, err := strconv.Atoi(tp.MaxLength); err == nil && n > maxLength {
+		n = maxLength
+	}
+	return n
+}
+
+// boundedValue returns the number value, or a number between the bounds of the restriction when it is outside
+// them. Integers are moved to the closest allowed integer, decimals to the inclusive bound, or one past or
+// halfway to the other bound for exclusive bounds.
+func boundedValue(value string, tp ElementType, integer bool) string {
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value
+	}
+	bound := func(facet string) (float64, bool) {
+		f, err := strconv.ParseFloat(facet, 64)
+		return f, err == nil
+	}
+	minInclusive, hasMinInclusive := bound(tp.MinInclusive)
+	maxInclusive, hasMaxInclusive := bound(tp.MaxInclusive)
+	minExclusive, hasMinExclusive := bound(tp.MinExclusive)
+	maxExclusive, hasMaxExclusive := bound(tp.MaxExclusive)
+
+	if integer {
+		if hasMinExclusive {
+			minInclusive, hasMinInclusive = math.Floor(minExclusive)+1, true
+		}
+		if hasMaxExclusive {
+			maxInclusive, hasMaxInclusive = math.Ceil(maxExclusive)-1, true
+		}
+		if hasMinInclusive && number < minInclusive {
+			number = math.Ceil(minInclusive)
+		}
+		if hasMaxInclusive && number > maxInclusive {
+			number = math.Floor(maxInclusive)
+		}
+		return strconv.FormatFloat(number, 'f', 0, 64)
+	}
+
+	lower, hasLower := minInclusive, hasMinInclusive
+	if hasMinExclusive {
+		lower, hasLower = minExclusive, true
+	}
+	upper, hasUpper := maxInclusive, hasMaxInclusive
+	if hasMaxExclusive {
+		upper, hasUpper = maxExclusive, true
+	}
+	between := func(bound, step float64) float64 {
+		if hasLower && hasUpper {
+			return (lower + upper) / 2
+		}
+		return bound + step
+	}
+	switch {
+	case hasMinInclusive && number < minInclusive:
+		number = minInclusive
+	case hasMinExclusive && number <= minExclusive:
+		number = between(minExclusive, 1)
+	}
+	switch {
+	case hasMaxInclusive && number > maxInclusive:
+		number = maxInclusive
+	case hasMaxExclusive && number >= maxExclusive:
+		number = between(maxExclusive, -1)
+	}
+
+	text := strconv.FormatFloat(number, 'f', -1, 64)
+	if fractionDigits, err := strconv.Atoi(tp.FractionDigits); err == nil {
+		if _, fraction, ok := soap.DecimalDigits(text); ok && fraction > fractionDigits {
+			text = strconv.FormatFloat(number, 'f', fractionDigits, 64)
+		}
+	}
+	return text
+}
+
+// patternValue returns the shortest value matching a pattern facet, taking the first alternative and the
+// first printable character of classes
+func patternValue(pattern string) (string, bool) {
+
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+
+	var value strings.Builder
+	var write func(re *syntax.Regexp)
+	write = func(re *syntax.Regexp) {
+		switch re.Op {
+		case syntax.OpLiteral:
+			value.WriteString(string(re.Rune))
+		case syntax.OpCharClass:
+			// the first printable character, negated classes start at zero
+			for i := 0; i+1 < len(re.Rune); i += 2 {
+				if re.Rune[i+1] >= '0' {
+					r := re.Rune[i]
+					if r < '0' {
+						r = '0'
+					}
+					value.WriteRune(r)
+					break
+				}
+			}
+		case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+			value.WriteRune('x')
+		case syntax.OpCapture, syntax.OpPlus:
+			write(re.Sub[0])
+		case syntax.OpRepeat:
+			for i := 0; i < re.Min; i++ {
+				write(re.Sub[0])
+			}
+		case syntax.OpConcat:
+			for _, sub := range re.Sub {
+				write(sub)
+			}
+		case syntax.OpAlternate:
+			write(re.Sub[0])
+		}
+	}
+	write(re.Simplify())
+
+	return value.String(), true
+}
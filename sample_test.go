@@ -0,0 +1,95 @@
+package gowhistler
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSampleEnvelope(t *testing.T) {
+	wsdl, err := Parse("testdata/orders.wsdl")
+	require.NoError(t, err)
+
+	doc, err := wsdl.SampleEnvelope(wsdl.Bindings[0], wsdl.Bindings[0].Operations[0], false)
+	require.NoError(t, err)
+
+	order := doc.FindElement("//Body/PlaceOrder/Order")
+	require.NotNil(t, order)
+	require.Equal(t, "urn:example:orders", order.NamespaceURI())
+	require.Equal(t, "open", order.FindElement("Status").Text())
+	require.Equal(t, "2024-01-31T12:00:00Z", order.FindElement("Placed").Text())
+	require.Nil(t, order.FindElement("Comment"))
+	require.Len(t, order.FindElements("Line"), 2)
+	require.Equal(t, "AAA-0000", order.FindElement("Line/Sku").Text())
+	require.Equal(t, "string", order.FindElement("Line").SelectAttrValue("unit", ""))
+	require.NotNil(t, order.FindElement("Note"))
+
+	customer := doc.FindElement("//PlaceOrder/Customer")
+	require.Len(t, customer.ChildElements(), 1)
+	require.Equal(t, "Email", customer.ChildElements()[0].Tag)
+
+	doc, err = wsdl.SampleEnvelope(wsdl.Bindings[0], wsdl.Bindings[0].Operations[0], true)
+	require.NoError(t, err)
+	require.Equal(t, "true", doc.FindElement("//Body/PlaceOrderResponse/Accepted").Text())
+}
+
+func TestSampleHeadersAndRPC(t *testing.T) {
+	wsdl, err := Parse("testdata/wrapped.wsdl")
+	require.NoError(t, err)
+
+	doc, err := wsdl.SampleEnvelope(wsdl.Bindings[0], wsdl.Bindings[0].Operations[0], false)
+	require.NoError(t, err)
+	require.Equal(t, "urn:example:persons", doc.FindElement("//Header/Trace").NamespaceURI())
+	require.Equal(t, "true", doc.FindElement("//Body/GetPerson/Historic").Text())
+
+	wsdl, err = Parse("testdata/rpc.wsdl")
+	require.NoError(t, err)
+
+	doc, err = wsdl.SampleEnvelope(wsdl.Bindings[0], wsdl.Bindings[0].Operations[0], true)
+	require.NoError(t, err)
+	wrapper := doc.FindElement("//Body/GetQuoteResponse")
+	require.Equal(t, "urn:example:quotes", wrapper.NamespaceURI())
+	require.Equal(t, "", wrapper.FindElement("quote").NamespaceURI())
+	require.Equal(t, "", wrapper.FindElement("quote/Symbol").NamespaceURI())
+	require.Nil(t, wrapper.FindElement("quote/Chart"))
+}
+
+func TestSampleFacets(t *testing.T) {
+	wsdl, err := Parse("testdata/orders.wsdl")
+	require.NoError(t, err)
+
+	elm, err := wsdl.SampleElement("urn:example:orders:Limits")
+	require.NoError(t, err)
+	require.Equal(t, "10", elm.FindElement("Limit").Text())
+	require.Equal(t, "4.75", elm.FindElement("Rating").Text())
+	require.Equal(t, "st", elm.FindElement("Country").Text())
+	require.Equal(t, "stringxx", elm.FindElement("Name").Text())
+	require.Equal(t, "c2FtcA==", elm.FindElement("Checksum").Text())
+	require.Equal(t, "a a", elm.FindElement("Codes").Text())
+}
+
+func TestWriteSamples(t *testing.T) {
+	wsdl, err := Parse("testdata/orders.wsdl")
+	require.NoError(t, err)
+
+	elm, err := wsdl.SampleElement("urn:example:orders:PlaceOrderResponse")
+	require.NoError(t, err)
+	require.Equal(t, "PlaceOrderResponse", elm.Tag)
+
+	dir := t.TempDir()
+	require.NoError(t, wsdl.WriteSamples(dir))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.xml"))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{
+		filepath.Join(dir, "PlaceOrderIn_parameters.xml"),
+		filepath.Join(dir, "PlaceOrderOut_parameters.xml"),
+		filepath.Join(dir, "OrderBinding_PlaceOrder_Request.xml"),
+		filepath.Join(dir, "OrderBinding_PlaceOrder_Response.xml"),
+	}, files)
+
+	content, err := os.ReadFile(filepath.Join(dir, "PlaceOrderOut_parameters.xml"))
+	require.NoError(t, err)
+	require.Contains(t, string(content), `<PlaceOrderResponse xmlns="urn:example:orders">`)
+}
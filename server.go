@@ -0,0 +1,173 @@
+package gowhistler
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+// buildServer builds the interface implemented by servers of a port, and the constructor of the
+// http.Handler dispatching requests to it
+func buildServer(builder *Builder, portName, port, service string, ops []goOperation) {
+
+	serverName := portName + "Server"
+	builder.Imports["context"] = true
+
+	iface := fmt.Sprintf("// %s is implemented by servers of the %s port of the %s service\n", serverName, port, service)
+	iface += fmt.Sprintf("type %s interface {\n", serverName)
+	for _, op := range ops {
+		params := append([]string{"ctx context.Context"}, op.params()...)
+		iface += fmt.Sprintf("// %s serves the %s operation\n", op.Name, op.Name)
+		iface += fmt.Sprintf("%s(%s) (%s)\n", op.Name, strings.Join(params, ", "), strings.Join(op.results(), ", "))
+	}
+	iface += "}"
+	builder.Decls[serverName] = iface
+
+	handler := fmt.Sprintf("// New%sHandler creates an http.Handler serving the %s port with server\n", portName, port)
+	handler += fmt.Sprintf("func New%sHandler(server %s) *soap.Handler {\n", portName, serverName)
+	handler += "h := soap.NewHandler(\n"
+	for _, op := range ops {
+		args := append([]string{"ctx"}, op.requestEnvelope().names()...)
+
+		handler += "soap.Endpoint{\n"
+		handler += fmt.Sprintf("Operation: %s,\n", op.Operation)
+		handler += "Serve: func(ctx context.Context, decode func(*soap.Envelope) error) (*soap.Envelope, error) {\n"
+		handler += newValues(op.Input, op.InputHeaders, op.InputAttachments, "request", "headers", "attachments")
+		handler += fmt.Sprintf("if err := decode(%s); err != nil {\nreturn nil, err\n}\n", op.requestEnvelope())
+		handler += fmt.Sprintf("%s := server.%s(%s)\n", strings.Join(op.responseValues("err"), ", "), op.Name, strings.Join(args, ", "))
+		handler += "if err != nil {\nreturn nil, err\n}\n"
+		handler += fmt.Sprintf("return %s, nil\n", op.responseEnvelope())
+		handler += "},\n"
+		handler += "},\n"
+	}
+	handler += ")\n"
+	handler += "h.Documents = wsdlDocuments\n"
+	handler += "return h\n}"
+	builder.Decls["New"+portName+"Handler"] = handler
+}
+
+// buildMock builds an in-process implementation of the server interface of a port for tests, recording the
+// requests it receives and serving them with functions set by the test
+func buildMock(builder *Builder, portName, port string, ops []goOperation) {
+
+	mockName := portName + "Mock"
+	builder.Imports["context"] = true
+	builder.Imports["sync"] = true
+
+	mock := fmt.Sprintf("// %s is a mock of the %s port for tests, implementing %sServer. Serve it with New%sHandler, eg. in an\n", mockName, port, portName, portName)
+	mock += "// httptest.Server, set the functions serving the operations and check the requests received.\n"
+	mock += fmt.Sprintf("type %s struct {\n", mockName)
+	for _, op := range ops {
+		params := append([]string{"ctx context.Context"}, op.params()...)
+		mock += fmt.Sprintf("// %sFunc serves %s requests, a fault is returned if nil\n", op.Name, op.Name)
+		mock += fmt.Sprintf("%sFunc func(%s) (%s)\n", op.Name, strings.Join(params, ", "), strings.Join(op.results(), ", "))
+	}
+	mock += "\nmutex sync.Mutex\n"
+	for _, op := range ops {
+		mock += fmt.Sprintf("%s []%s\n", mockCalls(op), mockCallName(portName, op))
+	}
+	mock += "}\n\n"
+	mock += fmt.Sprintf("var _ %sServer = (*%s)(nil)", portName, mockName)
+	builder.Decls[mockName] = mock
+
+	for _, op := range ops {
+		callName := mockCallName(portName, op)
+		params := append([]string{"ctx context.Context"}, op.params()...)
+		args := append([]string{"ctx"}, paramNames(op.params())...)
+
+		call := fmt.Sprintf("// %s is a %s request received by %s\n", callName, op.Name, mockName)
+		call += fmt.Sprintf("type %s struct {\n", callName)
+		for _, param := range op.params() {
+			call += ucFirst(param) + "\n"
+		}
+		call += "}"
+		builder.Decls[callName] = call
+
+		values := make([]string, 0, len(op.params()))
+		for _, name := range paramNames(op.params()) {
+			values = append(values, fmt.Sprintf("%s: %s", ucFirst(name), name))
+		}
+		results := op.results()
+		zero := make([]string, 0, len(results))
+		for range results[:len(results)-1] {
+			zero = append(zero, "nil")
+		}
+
+		method := fmt.Sprintf("// %s records the request and serves it with %sFunc\n", op.Name, op.Name)
+		method += fmt.Sprintf("func (m *%s) %s(%s) (%s) {\n", mockName, op.Name, strings.Join(params, ", "), strings.Join(results, ", "))
+		method += "m.mutex.Lock()\n"
+		method += fmt.Sprintf("m.%s = append(m.%s, %s{%s})\n", mockCalls(op), mockCalls(op), callName, strings.Join(values, ", "))
+		method += fmt.Sprintf("serve := m.%sFunc\n", op.Name)
+		method += "m.mutex.Unlock()\n"
+		method += "if serve == nil {\n"
+		method += fmt.Sprintf("return %s\n", strings.Join(append(zero, fmt.Sprintf("&soap.Fault{Code: \"soap:Server\", String: %q}", mockName+": "+op.Name+" is not mocked")), ", "))
+		method += "}\n"
+		method += fmt.Sprintf("return serve(%s)\n}", strings.Join(args, ", "))
+		builder.Decls[mockName+"."+op.Name] = method
+
+		returnNames := op.responseValues("err")
+		returnParams := make([]string, len(results))
+		for i, result := range results {
+			returnParams[i] = returnNames[i] + " " + result
+		}
+		canned := fmt.Sprintf("// Return%s serves %s requests with a canned response, or a fault if err is not nil\n", op.Name, op.Name)
+		canned += fmt.Sprintf("func (m *%s) Return%s(%s) {\n", mockName, op.Name, strings.Join(returnParams, ", "))
+		canned += "m.mutex.Lock()\n"
+		canned += "defer m.mutex.Unlock()\n"
+		canned += fmt.Sprintf("m.%sFunc = func(%s) (%s) {\n", op.Name, strings.Join(params, ", "), strings.Join(results, ", "))
+		canned += fmt.Sprintf("return %s\n}\n}", strings.Join(returnNames, ", "))
+		builder.Decls[mockName+".Return"+op.Name] = canned
+
+		calls := fmt.Sprintf("// %sCalls returns the %s requests received so far\n", op.Name, op.Name)
+		calls += fmt.Sprintf("func (m *%s) %sCalls() []%s {\n", mockName, op.Name, callName)
+		calls += "m.mutex.Lock()\n"
+		calls += "defer m.mutex.Unlock()\n"
+		calls += fmt.Sprintf("return append([]%s{}, m.%s...)\n}", callName, mockCalls(op))
+		builder.Decls[mockName+"."+op.Name+"Calls"] = calls
+	}
+}
+
+// mockCallName is the type of the requests of an operation recorded by a mock
+func mockCallName(portName string, op goOperation) string {
+	return portName + "_" + op.Name + "_Call"
+}
+
+// mockCalls is the field of a mock recording the requests of an operation
+func mockCalls(op goOperation) string {
+	return lcFirst(op.Name) + "Calls"
+}
+
+// paramNames returns the names of parameters declared as "name type"
+func paramNames(params []string) []string {
+	names := make([]string, len(params))
+	for i, param := range params {
+		names[i] = strings.Fields(param)[0]
+	}
+	return names
+}
+
+// BuildDocuments embeds the WSDL and its schemas, so generated servers can serve them
+func (wsdl *WSDL) BuildDocuments(builder *Builder) error {
+
+	decl := "// wsdlDocuments are the WSDL and the schemas it was generated from\n"
+	decl += "var wsdlDocuments = []soap.Document{\n"
+	for _, document := range wsdl.Documents {
+		content, err := document.Doc.WriteToString()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		literal := "`" + content + "`"
+		if strings.Contains(content, "`") {
+			literal = strconv.Quote(content)
+		}
+		decl += fmt.Sprintf("{Location: %q, Content: %s},\n", document.Location, literal)
+	}
+	decl += "}"
+
+	builder.Imports["github.com/keanpedersen/gowhistler/soap"] = true
+	builder.Decls["wsdlDocuments"] = decl
+
+	return nil
+}
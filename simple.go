@@ -0,0 +1,163 @@
+package gowhistler
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// buildList builds the slice type of an xs:list, encoded as text with the items separated by spaces
+func (wsdl *WSDL) buildList(builder *Builder, tp ElementType) (string, error) {
+
+	itemTp, ok := wsdl.TypeMap[strings.ToLower(tp.ListItem)]
+	if !ok {
+		return "", errors.Errorf("Could not find item type %v", tp.ListItem)
+	}
+	if err := wsdl.BuildType(builder, itemTp); err != nil {
+		return "", err
+	}
+	builder.useType(itemTp.TypeName())
+	builder.Imports["strings"] = true
+
+	typeName := tp.TypeName()
+	encode, text := wsdl.textEncoding(builder, itemTp, "item")
+	decode, fails := wsdl.textDecoding(builder, itemTp, "field")
+	if fails {
+		decode += "if err != nil {\nreturn err\n}\n"
+	}
+
+	builder.Decls[typeName+".MarshalText"] = fmt.Sprintf(`// MarshalText encodes the items of the list separated by spaces
+func (l %s) MarshalText() ([]byte, error) {
+	items := make([]string, len(l))
+	for i, item := range l {
+%sitems[i] = %s
+	}
+	return []byte(strings.Join(items, " ")), nil
+}`, typeName, encode, text)
+
+	builder.Decls[typeName+".UnmarshalText"] = fmt.Sprintf(`// UnmarshalText decodes the space separated items of the list
+func (l *%s) UnmarshalText(text []byte) error {
+	*l = nil
+	for _, field := range strings.Fields(string(text)) {
+%s*l = append(*l, member)
+	}
+	return nil
+}`, typeName, decode)
+
+	return "[]" + itemTp.TypeName(), nil
+}
+
+// unionField is the name of the field holding the i'th member of a union, the name of a named member type or
+// its position
+func (wsdl *WSDL) unionField(tp ElementType, i int) string {
+	if memberTp := wsdl.TypeMap[strings.ToLower(tp.UnionMembers[i])]; memberTp.Internal {
+		return fmt.Sprintf("Member%d", i+1)
+	}
+	_, name := splitFullName(tp.UnionMembers[i])
+	return ucFirst(makeTypeName(name))
+}
+
+// buildUnion builds the struct of an xs:union, with a field for each member type. Decoding tries the members
+// in order, taking the first that accepts the text and is valid.
+func (wsdl *WSDL) buildUnion(builder *Builder, tp ElementType) (string, error) {
+
+	typeName := tp.TypeName()
+	thisType := "struct {\n"
+	marshal, unmarshal := "", ""
+	complete := false // a member accepts any text, the following are never tried
+
+	for i, member := range tp.UnionMembers {
+		memberTp, ok := wsdl.TypeMap[strings.ToLower(member)]
+		if !ok {
+			return "", errors.Errorf("Could not find member type %v", member)
+		}
+		if err := wsdl.BuildType(builder, memberTp); err != nil {
+			return "", err
+		}
+		builder.useType(memberTp.TypeName())
+
+		field := wsdl.unionField(tp, i)
+		thisType += fmt.Sprintf("%s *%s\n", field, memberTp.TypeName())
+
+		encode, text := wsdl.textEncoding(builder, memberTp, "member")
+		marshal += fmt.Sprintf("if u.%[1]s != nil {\nmember := *u.%[1]s\n%[2]sreturn []byte(%[3]s), nil\n}\n", field, encode, text)
+
+		if complete {
+			continue
+		}
+		decode, fails := wsdl.textDecoding(builder, memberTp, "value")
+		var conditions []string
+		if fails {
+			conditions = append(conditions, "err == nil")
+		}
+		if memberTp.BuildIn == "" {
+			conditions = append(conditions, "member.Validate() == nil")
+		}
+		if len(conditions) == 0 {
+			unmarshal += fmt.Sprintf("%su.%s = &member\nreturn nil\n", decode, field)
+			complete = true
+			continue
+		}
+		unmarshal += fmt.Sprintf("{\n%sif %s {\nu.%s = &member\nreturn nil\n}\n}\n", decode, strings.Join(conditions, " && "), field)
+	}
+	thisType += "}"
+
+	if !complete {
+		builder.Imports["fmt"] = true
+		unmarshal += fmt.Sprintf("return fmt.Errorf(%q, value)\n", "value %q is not a member of the union")
+	}
+	builder.Imports["strings"] = true
+
+	builder.Decls[typeName+".MarshalText"] = fmt.Sprintf(`// MarshalText encodes the member of the union which is set
+func (u %s) MarshalText() ([]byte, error) {
+%sreturn nil, nil
+}`, typeName, marshal)
+
+	builder.Decls[typeName+".UnmarshalText"] = fmt.Sprintf(`// UnmarshalText sets the first member of the union accepting the text
+func (u *%[1]s) UnmarshalText(text []byte) error {
+	*u = %[1]s{}
+	value := strings.TrimSpace(string(text))
+%[2]s}`, typeName, unmarshal)
+
+	return thisType, nil
+}
+
+// textEncoding returns the statements and the string expression encoding value, of a simple type, as text
+func (wsdl *WSDL) textEncoding(builder *Builder, tp ElementType, value string) (stmts, text string) {
+
+	switch kind := wsdl.baseKind(tp); kind {
+	case "string":
+		return "", "string(" + value + ")"
+	case "int":
+		builder.Imports["strconv"] = true
+		return "", "strconv.Itoa(int(" + value + "))"
+	case "bool":
+		builder.Imports["strconv"] = true
+		return "", "strconv.FormatBool(bool(" + value + "))"
+	case "time.Time", "soap.Binary":
+		builder.useType(kind)
+		value = kind + "(" + value + ")"
+	}
+	return fmt.Sprintf("text, err := %s.MarshalText()\nif err != nil {\nreturn nil, err\n}\n", value), "string(text)"
+}
+
+// textDecoding returns the statements decoding text into a variable named member of a simple type. When
+// decoding can fail, they also declare err.
+func (wsdl *WSDL) textDecoding(builder *Builder, tp ElementType, text string) (stmts string, fails bool) {
+
+	typeName := tp.TypeName()
+	switch kind := wsdl.baseKind(tp); kind {
+	case "string":
+		return fmt.Sprintf("member := %s(%s)\n", typeName, text), false
+	case "int":
+		builder.Imports["strconv"] = true
+		return fmt.Sprintf("n, err := strconv.Atoi(%s)\nmember := %s(n)\n", text, typeName), true
+	case "bool":
+		builder.Imports["strconv"] = true
+		return fmt.Sprintf("b, err := strconv.ParseBool(%s)\nmember := %s(b)\n", text, typeName), true
+	case "time.Time", "soap.Binary":
+		builder.useType(kind)
+		return fmt.Sprintf("var base %s\nerr := base.UnmarshalText([]byte(%s))\nmember := %s(base)\n", kind, text, typeName), true
+	}
+	return fmt.Sprintf("var member %s\nerr := member.UnmarshalText([]byte(%s))\n", typeName, text), true
+}
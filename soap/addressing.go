@@ -0,0 +1,67 @@
+package soap
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"github.com/pkg/errors"
+)
+
+// AddressingNamespace is the namespace of the WS-Addressing 1.0 headers
+const AddressingNamespace = "http://www.w3.org/2005/08/addressing"
+
+// AnonymousAddress asks for the reply on the back channel of the request
+const AnonymousAddress = AddressingNamespace + "/anonymous"
+
+type endpointReference struct {
+	Address string `xml:"http://www.w3.org/2005/08/addressing Address"`
+}
+
+func addressingName(local string) xml.Name {
+	return xml.Name{Space: AddressingNamespace, Local: local}
+}
+
+// addressRequest returns the envelope with the WS-Addressing headers of op added, and the message id the
+// response must relate to
+func addressRequest(op Operation, to string, request *Envelope) (*Envelope, string, error) {
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	h := hex.EncodeToString(b)
+	messageID := "urn:uuid:" + h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+
+	addressed := *request
+	addressed.Headers = append([]Header{
+		{Name: addressingName("Action"), Value: op.InputAction},
+		{Name: addressingName("To"), Value: to},
+		{Name: addressingName("MessageID"), Value: messageID},
+		{Name: addressingName("ReplyTo"), Value: endpointReference{Address: AnonymousAddress}},
+	}, request.Headers...)
+
+	return &addressed, messageID, nil
+}
+
+// addressReply returns the response with the WS-Addressing headers of a reply to messageID added
+func addressReply(op Operation, messageID string, response *Envelope) *Envelope {
+
+	addressed := *response
+	addressed.Headers = append([]Header{
+		{Name: addressingName("Action"), Value: op.OutputAction},
+		{Name: addressingName("RelatesTo"), Value: messageID},
+	}, response.Headers...)
+
+	return &addressed
+}
+
+// addressingHeader returns the envelope with a header added for decoding a WS-Addressing header into the
+// returned string
+func addressingHeader(env *Envelope, local string) (*Envelope, *string) {
+
+	value := new(string)
+	addressed := *env
+	addressed.Headers = append([]Header{{Name: addressingName(local), Value: value}}, env.Headers...)
+
+	return &addressed, value
+}
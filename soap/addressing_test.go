@@ -0,0 +1,67 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAddressing(t *testing.T) {
+
+	op := Operation{
+		Name:         "GetQuote",
+		Request:      xml.Name{Space: "urn:example:quotes", Local: "GetQuote"},
+		Response:     xml.Name{Space: "urn:example:quotes", Local: "GetQuoteResponse"},
+		Addressing:   true,
+		InputAction:  "urn:example:quotes:GetQuote",
+		OutputAction: "urn:example:quotes:GetQuoteResponse",
+	}
+
+	// the handler relates its replies to the request
+	handler := NewHandler(Endpoint{
+		Operation: op,
+		Serve: func(ctx context.Context, decode func(*Envelope) error) (*Envelope, error) {
+			request := new(quoteRequest)
+			if err := decode(&Envelope{Body: request}); err != nil {
+				return nil, err
+			}
+			return &Envelope{Body: &quoteResponse{Price: request.Symbol + "=1"}}, nil
+		},
+	})
+	doc := etree.NewDocument()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, doc.ReadFromBytes(body))
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	response := &quoteResponse{}
+	require.NoError(t, NewClient(server.URL).Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, &Envelope{Body: response}))
+	require.Equal(t, "ACME=1", response.Price)
+
+	require.Equal(t, op.InputAction, doc.FindElement("//Header/Action").Text())
+	require.Equal(t, AddressingNamespace, doc.FindElement("//Header/Action").NamespaceURI())
+	require.Equal(t, server.URL, doc.FindElement("//Header/To").Text())
+	require.Regexp(t, "^urn:uuid:", doc.FindElement("//Header/MessageID").Text())
+	require.Equal(t, AnonymousAddress, doc.FindElement("//Header/ReplyTo/Address").Text())
+
+	// replies to other messages are rejected
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">`+
+			`<soap:Header><wsa:RelatesTo xmlns:wsa="http://www.w3.org/2005/08/addressing">urn:uuid:other</wsa:RelatesTo></soap:Header>`+
+			`<soap:Body><GetQuoteResponse xmlns="urn:example:quotes"><price>1</price></GetQuoteResponse></soap:Body></soap:Envelope>`)
+	}))
+	defer other.Close()
+
+	err := NewClient(other.URL).Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, &Envelope{Body: &quoteResponse{}})
+	require.ErrorContains(t, err, "relates to")
+}
@@ -0,0 +1,287 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultTimeout is the default limit on the duration of the HTTP requests of a Client
+const DefaultTimeout = time.Minute
+
+// DefaultMaxResponseSize is the default limit on the size of response bodies accepted by a Client
+const DefaultMaxResponseSize = 10 << 20
+
+// Doer sends HTTP requests, *http.Client being the usual implementation
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+var defaultHTTPClient = &http.Client{Timeout: DefaultTimeout}
+
+// Client sends SOAP 1.1 requests to a single endpoint. Generated clients embed it.
+type Client struct {
+	URL string
+
+	// HTTPClient sends the requests, an *http.Client with DefaultTimeout if nil
+	HTTPClient Doer
+
+	// MaxResponseSize limits the size of response bodies, DefaultMaxResponseSize if zero
+	MaxResponseSize int64
+
+	// EnvelopeHandlers process every request envelope in order, eg. adding a UsernameToken
+	EnvelopeHandlers []EnvelopeHandler
+
+	// Verifier checks the signature of responses and faults. Faults failing the check are returned as untyped
+	// errors, their detail can not be trusted.
+	Verifier *Verifier
+
+	// MTOM sends the Binary values of requests as MTOM/XOP attachments. MTOM responses are always accepted.
+	MTOM bool
+
+	// Interceptors wrap every round trip in order, the first being outermost. They see the request
+	// after the envelope handlers.
+	Interceptors []Interceptor
+
+	// ValidateRequests calls the Validate method of the request body and header values before sending
+	ValidateRequests bool
+}
+
+// ClientOption configures a Client created by NewClient
+type ClientOption func(*Client)
+
+// WithHTTPClient sends the requests with client, eg. an *http.Client configured for client certificates
+func WithHTTPClient(client Doer) ClientOption {
+	return func(c *Client) {
+		c.HTTPClient = client
+	}
+}
+
+// WithTransport sends the requests with transport, eg. an *http.Transport with a proxy or client
+// certificates, keeping DefaultTimeout
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		c.HTTPClient = &http.Client{Transport: transport, Timeout: DefaultTimeout}
+	}
+}
+
+// WithMaxResponseSize limits the size of response bodies
+func WithMaxResponseSize(size int64) ClientOption {
+	return func(c *Client) {
+		c.MaxResponseSize = size
+	}
+}
+
+// WithValidation validates the requests before sending, see Client.ValidateRequests
+func WithValidation() ClientOption {
+	return func(c *Client) {
+		c.ValidateRequests = true
+	}
+}
+
+func NewClient(url string, opts ...ClientOption) *Client {
+	c := &Client{
+		URL:             url,
+		HTTPClient:      defaultHTTPClient,
+		MaxResponseSize: DefaultMaxResponseSize,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// CallOption changes a single call of a Client
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	url         string
+	headers     []Header
+	httpHeaders http.Header
+	timeout     time.Duration
+}
+
+// WithURL sends the call to url instead of the URL of the client
+func WithURL(url string) CallOption {
+	return func(o *callOptions) {
+		o.url = url
+	}
+}
+
+// WithHeaders adds SOAP header blocks to the request
+func WithHeaders(headers ...Header) CallOption {
+	return func(o *callOptions) {
+		o.headers = append(o.headers, headers...)
+	}
+}
+
+// WithHTTPHeader adds an HTTP header to the request
+func WithHTTPHeader(key, value string) CallOption {
+	return func(o *callOptions) {
+		o.httpHeaders.Add(key, value)
+	}
+}
+
+// WithTimeout limits the duration of the call, within any deadline of the context
+func WithTimeout(timeout time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = timeout
+	}
+}
+
+// Call sends the request envelope and decodes the reply into the response envelope. The bodies
+// may be nil for operations without input or output.
+func (c *Client) Call(ctx context.Context, op Operation, request, response *Envelope, opts ...CallOption) error {
+
+	options := callOptions{url: c.URL, httpHeaders: make(http.Header)}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.timeout)
+		defer cancel()
+	}
+	if len(options.headers) > 0 {
+		withHeaders := *request
+		withHeaders.Headers = append(append([]Header{}, request.Headers...), options.headers...)
+		request = &withHeaders
+	}
+
+	if c.ValidateRequests {
+		if err := validateEnvelope(request); err != nil {
+			return err
+		}
+	}
+
+	var messageID string
+	if op.Addressing {
+		var err error
+		request, messageID, err = addressRequest(op, options.url, request)
+		if err != nil {
+			return err
+		}
+	}
+
+	var payload []byte
+	var binaries []xopBinary
+	var err error
+	if c.MTOM {
+		payload, binaries, err = marshalXOP(prefixedElement(op.Request), request)
+	} else {
+		payload, err = marshalEnvelope(prefixedElement(op.Request), request)
+	}
+	if err != nil {
+		return err
+	}
+
+	payload, err = handleRequest(c.EnvelopeHandlers, op, payload)
+	if err != nil {
+		return err
+	}
+
+	exchange := &Exchange{
+		Operation:      op,
+		SOAPAction:     strconv.Quote(op.Action),
+		URL:            options.url,
+		Header:         options.httpHeaders,
+		Request:        request,
+		RequestPayload: payload,
+		Response:       response,
+		messageID:      messageID,
+		binaries:       binaries,
+	}
+	return chain(c.Interceptors, c.roundTrip)(ctx, exchange)
+}
+
+// roundTrip sends the request payload of the exchange and decodes the response
+func (c *Client) roundTrip(ctx context.Context, exchange *Exchange) error {
+
+	op, request, response := exchange.Operation, exchange.Request, exchange.Response
+
+	payload, contentType := exchange.RequestPayload, "text/xml; charset=utf-8"
+	if c.MTOM || len(request.Attachments) > 0 {
+		var err error
+		payload, contentType, err = packMultipart(payload, c.MTOM, exchange.binaries, request.Attachments)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, exchange.URL, bytes.NewReader(payload))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for key, values := range exchange.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("SOAPAction", exchange.SOAPAction)
+
+	var client Doer = defaultHTTPClient
+	if c.HTTPClient != nil {
+		client = c.HTTPClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	exchange.StatusCode = resp.StatusCode
+
+	// faults are sent with status 500
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusInternalServerError {
+		return errors.Errorf("soap: %v returned HTTP status %v", op.Name, resp.Status)
+	}
+
+	maxSize := c.MaxResponseSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxResponseSize
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if int64(len(body)) > maxSize {
+		return errors.Errorf("soap: %v response exceeds %v bytes", op.Name, maxSize)
+	}
+	body, attachments, err := unpackMultipart(resp.Header.Get("Content-Type"), body)
+	if err != nil {
+		return err
+	}
+	exchange.ResponsePayload = body
+
+	if c.Verifier != nil {
+		response.Certificate, err = verifyPayload(c.Verifier, body)
+		if err != nil && resp.StatusCode != http.StatusOK {
+			return errors.Wrapf(err, "soap: %v returned an unverified fault", op.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	decoded, relatesTo := response, new(string)
+	if op.Addressing {
+		decoded, relatesTo = addressingHeader(response, "RelatesTo")
+	}
+	if err := unmarshalEnvelope(bytes.NewReader(body), decoded, op.Faults); err != nil {
+		return err
+	}
+	setAttachments(response, attachments)
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("soap: %v returned HTTP status %v without a fault", op.Name, resp.Status)
+	}
+
+	if op.Addressing && *relatesTo != exchange.messageID {
+		return errors.Errorf("soap: %v response relates to %q, not the request %v", op.Name, *relatesTo, exchange.messageID)
+	}
+
+	return nil
+}
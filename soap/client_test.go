@@ -0,0 +1,281 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type quoteRequest struct {
+	Symbol string `xml:"symbol"`
+}
+
+type quoteResponse struct {
+	Price string `xml:"price"`
+}
+
+func TestCallRPC(t *testing.T) {
+
+	op := Operation{
+		Name:     "GetQuote",
+		Action:   "urn:example:quotes:GetQuote",
+		Style:    StyleRPC,
+		Request:  xml.Name{Space: "urn:example:quotes", Local: "GetQuote"},
+		Response: xml.Name{Space: "urn:example:quotes", Local: "GetQuoteResponse"},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, `"urn:example:quotes:GetQuote"`, r.Header.Get("SOAPAction"))
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Contains(t, string(body), `<ns:GetQuote xmlns:ns="urn:example:quotes"><symbol>ACME</symbol></ns:GetQuote>`)
+
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		io.WriteString(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+			`<q:GetQuoteResponse xmlns:q="urn:example:quotes"><price>42.10</price></q:GetQuoteResponse>`+
+			`</soap:Body></soap:Envelope>`)
+	}))
+	defer server.Close()
+
+	response := &quoteResponse{}
+	err := NewClient(server.URL).Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, &Envelope{Body: response})
+	require.NoError(t, err)
+	require.Equal(t, "42.10", response.Price)
+}
+
+type trace struct {
+	ID string `xml:"Id"`
+}
+
+func TestCallHeaders(t *testing.T) {
+
+	op := Operation{
+		Name:     "GetQuote",
+		Style:    StyleDocument,
+		Request:  xml.Name{Space: "urn:example:quotes", Local: "GetQuote"},
+		Response: xml.Name{Space: "urn:example:quotes", Local: "GetQuoteResponse"},
+	}
+	traceName := xml.Name{Space: "urn:example:trace", Local: "Trace"}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Contains(t, string(body), `<soap:Header><ns:Trace xmlns:ns="urn:example:trace"><Id>in</Id></ns:Trace></soap:Header>`)
+		require.NotContains(t, string(body), "Missing")
+
+		io.WriteString(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Header>`+
+			`<o:Other xmlns:o="urn:example:other"><o:Id>skipped</o:Id></o:Other>`+
+			`<t:Trace xmlns:t="urn:example:trace"><Id>out</Id></t:Trace>`+
+			`</soap:Header><soap:Body><q:GetQuoteResponse xmlns:q="urn:example:quotes"><price>1</price></q:GetQuoteResponse></soap:Body></soap:Envelope>`)
+	}))
+	defer server.Close()
+
+	var missing *trace
+	var received *trace
+	response := &quoteResponse{}
+	err := NewClient(server.URL).Call(context.Background(), op,
+		&Envelope{
+			Headers: []Header{{Name: traceName, Value: &trace{ID: "in"}}, {Name: xml.Name{Local: "Missing"}, Value: missing}},
+			Body:    &quoteRequest{Symbol: "ACME"},
+		},
+		&Envelope{
+			Headers: []Header{{Name: traceName, Value: &received}},
+			Body:    response,
+		})
+	require.NoError(t, err)
+	require.Equal(t, "out", received.ID)
+	require.Equal(t, "1", response.Price)
+}
+
+func TestCallOptions(t *testing.T) {
+
+	op := Operation{
+		Name:     "GetQuote",
+		Style:    StyleDocument,
+		Request:  xml.Name{Space: "urn:example:quotes", Local: "GetQuote"},
+		Response: xml.Name{Space: "urn:example:quotes", Local: "GetQuoteResponse"},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		require.Equal(t, "/other", r.URL.Path)
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		require.Contains(t, string(body), `<soap:Header><ns:Trace xmlns:ns="urn:example:trace"><Id>option</Id></ns:Trace></soap:Header>`)
+
+		io.WriteString(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+			`<q:GetQuoteResponse xmlns:q="urn:example:quotes"><price>1</price></q:GetQuoteResponse></soap:Body></soap:Envelope>`)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL + "/slow")
+	request := &Envelope{Body: &quoteRequest{Symbol: "ACME"}}
+
+	response := &quoteResponse{}
+	err := client.Call(context.Background(), op, request, &Envelope{Body: response},
+		WithURL(server.URL+"/other"),
+		WithHeaders(Header{Name: xml.Name{Space: "urn:example:trace", Local: "Trace"}, Value: &trace{ID: "option"}}),
+		WithHTTPHeader("Authorization", "Bearer token"))
+	require.NoError(t, err)
+	require.Equal(t, "1", response.Price)
+	require.Empty(t, request.Headers)
+
+	err = client.Call(context.Background(), op, request, &Envelope{Body: &quoteResponse{}}, WithTimeout(10*time.Millisecond))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = client.Call(ctx, op, request, &Envelope{Body: &quoteResponse{}})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func (q quoteRequest) Validate() error {
+	if q.Symbol == "" {
+		return errors.New("Symbol is required")
+	}
+	return nil
+}
+
+func TestCallValidation(t *testing.T) {
+
+	op := Operation{
+		Name:     "GetQuote",
+		Style:    StyleDocument,
+		Request:  xml.Name{Space: "urn:example:quotes", Local: "GetQuote"},
+		Response: xml.Name{Space: "urn:example:quotes", Local: "GetQuoteResponse"},
+	}
+
+	sent := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent++
+		io.WriteString(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+			`<q:GetQuoteResponse xmlns:q="urn:example:quotes"><price>1</price></q:GetQuoteResponse></soap:Body></soap:Envelope>`)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, WithValidation())
+	err := client.Call(context.Background(), op, &Envelope{Body: &quoteRequest{}}, &Envelope{Body: &quoteResponse{}})
+	require.EqualError(t, err, "soap: invalid request: Symbol is required")
+	require.Equal(t, 0, sent)
+
+	err = client.Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, &Envelope{Body: &quoteResponse{}})
+	require.NoError(t, err)
+	require.Equal(t, 1, sent)
+
+	client.ValidateRequests = false
+	err = client.Call(context.Background(), op, &Envelope{Body: &quoteRequest{}}, &Envelope{Body: &quoteResponse{}})
+	require.NoError(t, err)
+	require.Equal(t, 2, sent)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestClientTransport(t *testing.T) {
+
+	op := Operation{
+		Name:     "GetQuote",
+		Style:    StyleDocument,
+		Request:  xml.Name{Space: "urn:example:quotes", Local: "GetQuote"},
+		Response: xml.Name{Space: "urn:example:quotes", Local: "GetQuoteResponse"},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+			`<q:GetQuoteResponse xmlns:q="urn:example:quotes"><price>1</price></q:GetQuoteResponse></soap:Body></soap:Envelope>`)
+	}))
+	defer server.Close()
+	request := &Envelope{Body: &quoteRequest{Symbol: "ACME"}}
+
+	client := NewClient(server.URL)
+	require.Equal(t, int64(DefaultMaxResponseSize), client.MaxResponseSize)
+	require.Equal(t, DefaultTimeout, client.HTTPClient.(*http.Client).Timeout)
+
+	var proxied []string
+	client = NewClient(server.URL, WithTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		proxied = append(proxied, req.URL.String())
+		return http.DefaultTransport.RoundTrip(req)
+	})))
+	require.NoError(t, client.Call(context.Background(), op, request, &Envelope{Body: &quoteResponse{}}))
+	require.Equal(t, []string{server.URL}, proxied)
+
+	client = NewClient(server.URL, WithHTTPClient(server.Client()), WithMaxResponseSize(50))
+	err := client.Call(context.Background(), op, request, &Envelope{Body: &quoteResponse{}})
+	require.EqualError(t, err, "soap: GetQuote response exceeds 50 bytes")
+}
+
+type notFoundError struct {
+	Fault  *Fault
+	Detail *trace
+}
+
+func (e *notFoundError) Error() string {
+	if e.Fault == nil {
+		return "NotFound"
+	}
+	return e.Fault.Error()
+}
+
+func (e *notFoundError) Unwrap() error {
+	if e.Fault == nil {
+		return nil
+	}
+	return e.Fault
+}
+
+func (e *notFoundError) FaultDetail() interface{} {
+	return e.Detail
+}
+
+func TestCallFault(t *testing.T) {
+
+	op := Operation{
+		Name:    "GetQuote",
+		Request: xml.Name{Space: "urn:example:quotes", Local: "GetQuote"},
+		Faults: []FaultType{{
+			Detail: xml.Name{Space: "urn:example:quotes", Local: "NotFound"},
+			New: func(fault *Fault) DetailError {
+				return &notFoundError{Fault: fault, Detail: new(trace)}
+			},
+		}},
+	}
+
+	detail := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:q="urn:example:quotes"><soap:Body><soap:Fault>`+
+			`<faultcode>soap:Client</faultcode><faultstring>No such symbol</faultstring>`+
+			`<detail>`+detail+`</detail></soap:Fault></soap:Body></soap:Envelope>`)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+
+	detail = `<q:NotFound><Id>ACME</Id></q:NotFound>`
+	err := client.Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, &Envelope{})
+	var notFound *notFoundError
+	require.True(t, errors.As(err, &notFound))
+	require.Equal(t, "ACME", notFound.Detail.ID)
+	require.Equal(t, "soap:Client", notFound.Fault.Code)
+
+	detail = `<q:Other/>`
+	err = client.Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, &Envelope{})
+	var fault *Fault
+	require.False(t, errors.As(err, &notFound))
+	require.True(t, errors.As(err, &fault))
+	require.Equal(t, "No such symbol", fault.String)
+}
@@ -0,0 +1,79 @@
+package soap
+
+import (
+	"fmt"
+	"github.com/beevik/etree"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// Document is a WSDL or schema document served by a Handler
+type Document struct {
+	Location string // the location other documents reference it by
+	Content  string
+}
+
+// serveDocument serves the WSDL on ?wsdl and the schemas on ?xsd=N, with every reference between them
+// and the service address rewritten to point at this handler
+func (h *Handler) serveDocument(w http.ResponseWriter, r *http.Request) {
+
+	query := r.URL.Query()
+
+	index := -1
+	if _, ok := query["wsdl"]; ok {
+		index = 0
+	} else if n, err := strconv.Atoi(query.Get("xsd")); err == nil && n > 0 && n < len(h.Documents) {
+		index = n
+	}
+	if index < 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	base := fmt.Sprintf("%s://%s%s", scheme, r.Host, r.URL.Path)
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(h.Documents[index].Content); err != nil {
+		log.Printf("soap: could not read document %v: %+v\n", h.Documents[index].Location, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.rewriteLocations(doc.Root(), base)
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	doc.WriteTo(w)
+}
+
+// rewriteLocations points schema and WSDL imports at the served documents, and addresses at base
+func (h *Handler) rewriteLocations(elm *etree.Element, base string) {
+
+	for i, attr := range elm.Attr {
+		switch {
+		case attr.Space == "" && (attr.Key == "schemaLocation" || (attr.Key == "location" && elm.Tag == "import")):
+			for n, document := range h.Documents {
+				if document.Location == attr.Value {
+					elm.Attr[i].Value = documentURL(base, n)
+				}
+			}
+		case attr.Space == "" && attr.Key == "location" && elm.Tag == "address":
+			elm.Attr[i].Value = base
+		}
+	}
+
+	for _, child := range elm.ChildElements() {
+		h.rewriteLocations(child, base)
+	}
+}
+
+func documentURL(base string, n int) string {
+	if n == 0 {
+		return base + "?wsdl"
+	}
+	return base + "?xsd=" + strconv.Itoa(n)
+}
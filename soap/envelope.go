@@ -0,0 +1,263 @@
+package soap
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/xml"
+	"github.com/pkg/errors"
+	"io"
+)
+
+// EnvelopeNamespace is the namespace of SOAP 1.1 envelopes
+const EnvelopeNamespace = "http://schemas.xmlsoap.org/soap/envelope/"
+
+// Binding styles, matching the style attributes of the WSDL soap binding
+const (
+	StyleDocument = "document"
+	StyleRPC      = "rpc"
+)
+
+// Operation describes a single operation of a generated client, as found in the WSDL binding
+type Operation struct {
+	Name   string
+	Action string
+	Style  string
+
+	// Request and Response are the names of the elements put in the SOAP body. For
+	// document style operations these are the elements of the message parts, for rpc
+	// style operations they are the operation wrappers.
+	Request  xml.Name
+	Response xml.Name
+
+	// Faults are the declared faults of the operation, decoded into typed errors
+	Faults []FaultType
+
+	// Addressing adds the WS-Addressing headers to requests, with InputAction as wsa:Action, and requires
+	// responses to relate to their request
+	Addressing   bool
+	InputAction  string
+	OutputAction string
+}
+
+// Header is a SOAP header block. When receiving, Value must be a pointer the block is decoded into.
+type Header struct {
+	Name  xml.Name
+	Value interface{}
+}
+
+// Envelope holds the typed headers and body of a SOAP message
+type Envelope struct {
+	Headers     []Header
+	Body        interface{}
+	Attachments []Attachment
+
+	// Certificate is set on received envelopes whose signature was checked by a Verifier
+	Certificate *x509.Certificate
+}
+
+// prefixedElement returns the start element header blocks and bodies are written as. The prefix leaves their
+// unqualified children in no namespace, as the part accessors of rpc wrappers (WS-I BP R2735) and the local
+// elements of schemas with unqualified elementFormDefault.
+func prefixedElement(name xml.Name) xml.StartElement {
+	if name.Space == "" {
+		return xml.StartElement{Name: name}
+	}
+	return xml.StartElement{
+		Name: xml.Name{Local: "ns:" + name.Local},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns:ns"}, Value: name.Space}},
+	}
+}
+
+// marshalEnvelope encodes the envelope, writing the body as the given element
+func marshalEnvelope(start xml.StartElement, env *Envelope) ([]byte, error) {
+
+	buf := &bytes.Buffer{}
+	if err := writeEnvelope(buf, xml.NewEncoder(buf), start, env); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeEnvelope writes the envelope to buf, encoding the headers and body with enc writing to buf
+func writeEnvelope(buf *bytes.Buffer, enc *xml.Encoder, start xml.StartElement, env *Envelope) error {
+
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<soap:Envelope xmlns:soap="` + EnvelopeNamespace + `">`)
+	if len(env.Headers) > 0 {
+		buf.WriteString(`<soap:Header>`)
+		for _, header := range env.Headers {
+			if err := enc.EncodeElement(header.Value, prefixedElement(header.Name)); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		if err := enc.Flush(); err != nil {
+			return errors.WithStack(err)
+		}
+		buf.WriteString(`</soap:Header>`)
+	}
+	buf.WriteString(`<soap:Body>`)
+	if env.Body != nil {
+		if err := enc.EncodeElement(env.Body, start); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := enc.Flush(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	buf.WriteString(`</soap:Body></soap:Envelope>`)
+
+	return nil
+}
+
+// marshalFault encodes an envelope holding the fault, with the detail written as the given element
+func marshalFault(fault *Fault, name xml.Name, detail interface{}) ([]byte, error) {
+
+	buf := &bytes.Buffer{}
+	enc := xml.NewEncoder(buf)
+
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<soap:Envelope xmlns:soap="` + EnvelopeNamespace + `"><soap:Body><soap:Fault>`)
+	for _, field := range []struct{ name, value string }{{"faultcode", fault.Code}, {"faultstring", fault.String}, {"faultactor", fault.Actor}} {
+		if field.value == "" && field.name == "faultactor" {
+			continue
+		}
+		buf.WriteString("<" + field.name + ">")
+		if err := xml.EscapeText(buf, []byte(field.value)); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		buf.WriteString("</" + field.name + ">")
+	}
+	if detail != nil {
+		buf.WriteString(`<detail>`)
+		if err := enc.EncodeElement(detail, xml.StartElement{Name: name}); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := enc.Flush(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		buf.WriteString(`</detail>`)
+	}
+	buf.WriteString(`</soap:Fault></soap:Body></soap:Envelope>`)
+
+	return buf.Bytes(), nil
+}
+
+// bodyElement returns the name of the first element in the SOAP body
+func bodyElement(r io.Reader) (name xml.Name, err error) {
+	dec := xml.NewDecoder(r)
+
+	depth := 0
+	inBody := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return name, errors.New("soap: no body element found in envelope")
+		}
+		if err != nil {
+			return name, errors.WithStack(err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				inBody = tok.Name.Space == EnvelopeNamespace && tok.Name.Local == "Body"
+			}
+			if depth == 3 && inBody {
+				return tok.Name, nil
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+// unmarshalEnvelope decodes the known header blocks and the first element of the SOAP body. If the
+// body holds a fault, it is returned as the error. Envelopes repeating the header, the body or the
+// wsse:Security block are rejected, as the Verifier checks only the first of them.
+func unmarshalEnvelope(r io.Reader, env *Envelope, faults []FaultType) error {
+	dec := xml.NewDecoder(r)
+
+	// depth 1 is the envelope, 2 the header and body, 3 their children
+	depth := 0
+	inHeader, inBody := false, false
+	seen := make(map[xml.Name]bool)
+	unique := func(name xml.Name) error {
+		if seen[name] {
+			return errors.Errorf("soap: envelope has more than one %v", name.Local)
+		}
+		seen[name] = true
+		return nil
+	}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return errors.New("soap: no body found in envelope")
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			depth++
+			switch depth {
+			case 1:
+				if tok.Name.Space != EnvelopeNamespace || tok.Name.Local != "Envelope" {
+					return errors.Errorf("soap: expected envelope, got %v", tok.Name.Local)
+				}
+			case 2:
+				inHeader = tok.Name.Space == EnvelopeNamespace && tok.Name.Local == "Header"
+				inBody = tok.Name.Space == EnvelopeNamespace && tok.Name.Local == "Body"
+				if inHeader || inBody {
+					if err := unique(tok.Name); err != nil {
+						return err
+					}
+				}
+			case 3:
+				depth--
+				if inHeader {
+					if tok.Name.Space == WSSENamespace && tok.Name.Local == "Security" {
+						if err := unique(tok.Name); err != nil {
+							return err
+						}
+					}
+					if err := decodeHeader(dec, tok, env.Headers); err != nil {
+						return err
+					}
+					continue
+				}
+				if inBody {
+					if tok.Name.Space == EnvelopeNamespace && tok.Name.Local == "Fault" {
+						return decodeFault(dec, faults)
+					}
+					if env.Body == nil {
+						return nil
+					}
+					return errors.WithStack(dec.DecodeElement(env.Body, &tok))
+				}
+				if err := dec.Skip(); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+		case xml.EndElement:
+			depth--
+			if inBody {
+				// empty body
+				return nil
+			}
+			inHeader = false
+		}
+	}
+}
+
+// decodeHeader decodes a header block into the matching header, or skips it if nobody asked for it
+func decodeHeader(dec *xml.Decoder, start xml.StartElement, headers []Header) error {
+	for _, header := range headers {
+		if header.Name == start.Name {
+			return errors.WithStack(dec.DecodeElement(header.Value, &start))
+		}
+	}
+
+	return errors.WithStack(dec.Skip())
+}
@@ -0,0 +1,108 @@
+package soap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+// Fault is a SOAP 1.1 fault. Faults without a known detail element are returned as *Fault.
+type Fault struct {
+	Code   string
+	String string
+	Actor  string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("soap fault %s: %s", f.Code, f.String)
+}
+
+// DetailError is implemented by the typed errors generated for wsdl:fault messages
+type DetailError interface {
+	error
+	// FaultDetail returns the pointer the detail element is decoded into
+	FaultDetail() interface{}
+}
+
+// FaultType maps the detail element of a declared fault to its typed error
+type FaultType struct {
+	Detail xml.Name
+	New    func(fault *Fault) DetailError
+}
+
+// decodeFault decodes a soap:Fault element, returning the typed error of the first matching fault type
+func decodeFault(dec *xml.Decoder, faults []FaultType) error {
+
+	fault := &Fault{}
+	var detailErr DetailError
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch tok.Name.Local {
+			case "faultcode":
+				err = dec.DecodeElement(&fault.Code, &tok)
+			case "faultstring":
+				err = dec.DecodeElement(&fault.String, &tok)
+			case "faultactor":
+				err = dec.DecodeElement(&fault.Actor, &tok)
+			case "detail":
+				detailErr, err = decodeFaultDetail(dec, fault, faults)
+			default:
+				err = dec.Skip()
+			}
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		case xml.EndElement:
+			if detailErr != nil {
+				return detailErr
+			}
+			return fault
+		}
+	}
+}
+
+// decodeFaultDetail decodes the first child of the detail element matching one of the fault types,
+// and skips the rest of the detail
+func decodeFaultDetail(dec *xml.Decoder, fault *Fault, faults []FaultType) (detailErr DetailError, err error) {
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			faultType := findFaultType(faults, tok.Name)
+			if detailErr != nil || faultType == nil {
+				if err := dec.Skip(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			detailErr = faultType.New(fault)
+			if err := dec.DecodeElement(detailErr.FaultDetail(), &tok); err != nil {
+				return nil, err
+			}
+		case xml.EndElement:
+			return detailErr, nil
+		}
+	}
+}
+
+func findFaultType(faults []FaultType, name xml.Name) *FaultType {
+	for i := range faults {
+		if faults[i].Detail == name {
+			return &faults[i]
+		}
+	}
+	return nil
+}
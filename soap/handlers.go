@@ -0,0 +1,76 @@
+package soap
+
+import (
+	"github.com/beevik/etree"
+	"github.com/pkg/errors"
+)
+
+// EnvelopeHandler processes the envelope of outgoing requests before it is sent, eg. adding security headers
+type EnvelopeHandler interface {
+	HandleRequest(op Operation, envelope *etree.Document) error
+}
+
+// handleRequest runs the envelope handlers on an encoded request
+func handleRequest(handlers []EnvelopeHandler, op Operation, payload []byte) ([]byte, error) {
+
+	if len(handlers) == 0 {
+		return payload, nil
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(payload); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, handler := range handlers {
+		if err := handler.HandleRequest(op, doc); err != nil {
+			return nil, err
+		}
+	}
+
+	ret, err := doc.WriteToBytes()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return ret, nil
+}
+
+// findChild returns the first child element with the given namespace and name
+func findChild(elm *etree.Element, space, tag string) *etree.Element {
+	for _, child := range elm.ChildElements() {
+		if child.Tag == tag && child.NamespaceURI() == space {
+			return child
+		}
+	}
+	return nil
+}
+
+// EnvelopeHeader returns the soap:Header of an envelope, creating it if missing
+func EnvelopeHeader(doc *etree.Document) (*etree.Element, error) {
+
+	root := doc.Root()
+	if root == nil || root.Tag != "Envelope" || root.NamespaceURI() != EnvelopeNamespace {
+		return nil, errors.New("soap: document is not a SOAP envelope")
+	}
+
+	if header := findChild(root, EnvelopeNamespace, "Header"); header != nil {
+		return header, nil
+	}
+
+	header := etree.NewElement("Header")
+	header.Space = root.Space
+	root.InsertChildAt(0, header)
+	return header, nil
+}
+
+// lookupNamespace resolves a prefix in the scope of elm, "" being the default namespace
+func lookupNamespace(elm *etree.Element, prefix string) string {
+	for e := elm; e != nil; e = e.Parent() {
+		for _, attr := range e.Attr {
+			if (prefix == "" && attr.Space == "" && attr.Key == "xmlns") || (attr.Space == "xmlns" && attr.Key == prefix) {
+				return attr.Value
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package soap
+
+import (
+	"context"
+	"net/http"
+)
+
+// Exchange is a single round trip of a Client, as seen by its interceptors
+type Exchange struct {
+	Operation  Operation
+	SOAPAction string
+	URL        string
+
+	// Header is the HTTP header of the request, interceptors may add to it, eg. authorization
+	Header http.Header
+
+	// Request is the typed request and RequestPayload the envelope encoded from it by the envelope
+	// handlers. Interceptors changing the payload are responsible for keeping it a valid envelope.
+	Request        *Envelope
+	RequestPayload []byte
+
+	// Response is decoded from ResponsePayload when the round trip returns, StatusCode being its
+	// HTTP status. They are only set when a response was received.
+	Response        *Envelope
+	ResponsePayload []byte
+	StatusCode      int
+
+	messageID string
+
+	// binaries are the elements of the payload whose content is sent as MTOM attachments
+	binaries []xopBinary
+}
+
+// Invoker performs the rest of a round trip, the next interceptor or finally the HTTP request
+type Invoker func(ctx context.Context, exchange *Exchange) error
+
+// Interceptor wraps the round trips of a Client, eg. logging, measuring or retrying them. An interceptor
+// calls next to continue the round trip, possibly more than once.
+type Interceptor interface {
+	Intercept(ctx context.Context, exchange *Exchange, next Invoker) error
+}
+
+// InterceptorFunc is an Interceptor as a function
+type InterceptorFunc func(ctx context.Context, exchange *Exchange, next Invoker) error
+
+func (f InterceptorFunc) Intercept(ctx context.Context, exchange *Exchange, next Invoker) error {
+	return f(ctx, exchange, next)
+}
+
+// chain wraps invoke in the interceptors, the first interceptor being called first
+func chain(interceptors []Interceptor, invoke Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoke
+		invoke = func(ctx context.Context, exchange *Exchange) error {
+			return interceptor.Intercept(ctx, exchange, next)
+		}
+	}
+	return invoke
+}
@@ -0,0 +1,68 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInterceptors(t *testing.T) {
+
+	op := Operation{
+		Name:     "GetQuote",
+		Action:   "urn:example:quotes:GetQuote",
+		Style:    StyleDocument,
+		Request:  xml.Name{Space: "urn:example:quotes", Local: "GetQuote"},
+		Response: xml.Name{Space: "urn:example:quotes", Local: "GetQuoteResponse"},
+	}
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		io.WriteString(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+			`<q:GetQuoteResponse xmlns:q="urn:example:quotes"><price>42.10</price></q:GetQuoteResponse></soap:Body></soap:Envelope>`)
+	}))
+	defer server.Close()
+
+	var calls []string
+	logger := InterceptorFunc(func(ctx context.Context, exchange *Exchange, next Invoker) error {
+		calls = append(calls, "log "+exchange.Operation.Name+" "+exchange.SOAPAction)
+		require.Contains(t, string(exchange.RequestPayload), "<symbol>ACME</symbol>")
+		require.Equal(t, "ACME", exchange.Request.Body.(*quoteRequest).Symbol)
+
+		err := next(ctx, exchange)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, exchange.StatusCode)
+		require.Contains(t, string(exchange.ResponsePayload), "<price>42.10</price>")
+		require.Equal(t, "42.10", exchange.Response.Body.(*quoteResponse).Price)
+		return err
+	})
+	retry := InterceptorFunc(func(ctx context.Context, exchange *Exchange, next Invoker) error {
+		calls = append(calls, "retry")
+		exchange.Header.Set("Authorization", "Bearer token")
+		if err := next(ctx, exchange); exchange.StatusCode != http.StatusServiceUnavailable {
+			return err
+		}
+		calls = append(calls, "retry again")
+		return next(ctx, exchange)
+	})
+
+	client := NewClient(server.URL)
+	client.Interceptors = []Interceptor{logger, retry}
+
+	response := &quoteResponse{}
+	err := client.Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, &Envelope{Body: response})
+	require.NoError(t, err)
+	require.Equal(t, "42.10", response.Price)
+	require.Equal(t, []string{`log GetQuote "urn:example:quotes:GetQuote"`, "retry", "retry again"}, calls)
+	require.Equal(t, 2, requests)
+}
@@ -0,0 +1,375 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"github.com/beevik/etree"
+	"github.com/pkg/errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// XOPNamespace is the namespace of the xop:Include elements referring to MTOM attachments
+const XOPNamespace = "http://www.w3.org/2004/08/xop/include"
+
+const mtomRootID = "root.message@gowhistler"
+
+// Attachment is a MIME part sent along an envelope as in SOAP with Attachments, named by the message part it
+// is bound to. When receiving, Value must point to where the content is stored.
+type Attachment struct {
+	Part        string
+	ContentType string
+	Value       *Binary
+}
+
+// Binary is the content of an xs:base64Binary element. It is sent as base64 text, or as an MTOM attachment
+// when the Client or Handler has MTOM enabled. Attachments of received MTOM messages are resolved into it.
+type Binary []byte
+
+func (b Binary) MarshalText() ([]byte, error) {
+	ret := make([]byte, base64.StdEncoding.EncodedLen(len(b)))
+	base64.StdEncoding.Encode(ret, b)
+	return ret, nil
+}
+
+func (b *Binary) UnmarshalText(text []byte) error {
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(text)), ""))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	*b = data
+	return nil
+}
+
+// Reader returns a reader of the content
+func (b Binary) Reader() io.Reader {
+	return bytes.NewReader(b)
+}
+
+// MarshalXML writes the base64 text of the content. Envelopes encoded by marshalXOP get a placeholder instead,
+// marking the element the content is moved out of.
+func (b Binary) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if v, ok := xopEncoders.Load(e); ok && len(b) > 0 {
+		placeholders := v.(*xopPlaceholders)
+		text := placeholders.prefix + strconv.Itoa(len(placeholders.values))
+		placeholders.values[text] = b
+		return e.EncodeElement(text, start)
+	}
+	text, err := b.MarshalText()
+	if err != nil {
+		return err
+	}
+	return e.EncodeElement(string(text), start)
+}
+
+// xopEncoders holds the placeholders written by the encoders of marshalXOP
+var xopEncoders sync.Map
+
+// xopPlaceholders are the unique texts written for Binary values and the values they stand for
+type xopPlaceholders struct {
+	prefix string
+	values map[string]Binary
+}
+
+// xopStep is a step of the path to an element, the tag of the element and its position among the siblings
+// with that tag
+type xopStep struct {
+	tag string
+	n   int
+}
+
+// xopBinary is an element holding a Binary value, located by its path from the root so that it is found
+// again after envelope handlers added headers and attributes
+type xopBinary struct {
+	path  []xopStep
+	value Binary
+}
+
+// marshalXOP encodes the envelope like marshalEnvelope, and returns the elements holding non-empty Binary
+// values, which packMultipart moves into attachments
+func marshalXOP(start xml.StartElement, env *Envelope) ([]byte, []xopBinary, error) {
+
+	prefix, err := newID("xop")
+	if err != nil {
+		return nil, nil, err
+	}
+	placeholders := &xopPlaceholders{prefix: prefix + "-", values: make(map[string]Binary)}
+
+	buf := &bytes.Buffer{}
+	enc := xml.NewEncoder(buf)
+	xopEncoders.Store(enc, placeholders)
+	defer xopEncoders.Delete(enc)
+	if err := writeEnvelope(buf, enc, start, env); err != nil {
+		return nil, nil, err
+	}
+	if len(placeholders.values) == 0 {
+		return buf.Bytes(), nil, nil
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(buf.Bytes()); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	var binaries []xopBinary
+	var walk func(elm *etree.Element, path []xopStep)
+	walk = func(elm *etree.Element, path []xopStep) {
+		if value, ok := placeholders.values[elm.Text()]; ok {
+			binaries = append(binaries, xopBinary{path: path, value: value})
+			text, _ := value.MarshalText()
+			elm.SetText(string(text))
+			return
+		}
+		seen := make(map[string]int)
+		for _, child := range elm.ChildElements() {
+			step := xopStep{tag: child.FullTag(), n: seen[child.FullTag()]}
+			seen[child.FullTag()]++
+			walk(child, append(append([]xopStep(nil), path...), step))
+		}
+	}
+	root := doc.Root()
+	walk(root, []xopStep{{tag: root.FullTag()}})
+
+	payload, err := doc.WriteToBytes()
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	return payload, binaries, nil
+}
+
+// find returns the element at the path in doc, nil if there is none
+func (b xopBinary) find(doc *etree.Document) *etree.Element {
+
+	elm := doc.Root()
+	if elm == nil || elm.FullTag() != b.path[0].tag {
+		return nil
+	}
+	for _, step := range b.path[1:] {
+		var next *etree.Element
+		n := 0
+		for _, child := range elm.ChildElements() {
+			if child.FullTag() != step.tag {
+				continue
+			}
+			if n == step.n {
+				next = child
+				break
+			}
+			n++
+		}
+		if next == nil {
+			return nil
+		}
+		elm = next
+	}
+	return elm
+}
+
+// packMultipart encodes an envelope as a multipart/related message with the attachments following it.
+// With mtom the message is an MTOM/XOP message, the contents of the binaries being moved into attachments.
+func packMultipart(payload []byte, mtom bool, binaries []xopBinary, attachments []Attachment) ([]byte, string, error) {
+
+	if len(binaries) > 0 {
+		doc := etree.NewDocument()
+		if err := doc.ReadFromBytes(payload); err != nil {
+			return nil, "", errors.WithStack(err)
+		}
+
+		for i, binary := range binaries {
+			elm := binary.find(doc)
+			if elm == nil {
+				return nil, "", errors.New("soap: element of binary content not found in the envelope")
+			}
+			elm.SetText("")
+			include := elm.CreateElement("xop:Include")
+			include.CreateAttr("xmlns:xop", XOPNamespace)
+			include.CreateAttr("href", "cid:"+attachmentID(i+1))
+		}
+
+		var err error
+		payload, err = doc.WriteToBytes()
+		if err != nil {
+			return nil, "", errors.WithStack(err)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+	writePart := func(contentType, id string, data []byte) error {
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"binary"},
+			"Content-ID":                {"<" + id + ">"},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, err = part.Write(data)
+		return errors.WithStack(err)
+	}
+
+	rootType, startInfo := "text/xml; charset=UTF-8", ""
+	if mtom {
+		rootType, startInfo = `application/xop+xml; charset=UTF-8; type="text/xml"`, "text/xml"
+	}
+	if err := writePart(rootType, mtomRootID, payload); err != nil {
+		return nil, "", err
+	}
+	for i, binary := range binaries {
+		if err := writePart("application/octet-stream", attachmentID(i+1), binary.value); err != nil {
+			return nil, "", err
+		}
+	}
+	for i, attachment := range attachments {
+		if attachment.Value == nil {
+			continue
+		}
+		contentType := attachment.ContentType
+		if contentType == "" || strings.Contains(contentType, "*") {
+			contentType = "application/octet-stream"
+		}
+		// WS-I Attachments Profile names the part in the Content-ID
+		if err := writePart(contentType, attachment.Part+"="+attachmentID(i+1), *attachment.Value); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	params := map[string]string{
+		"type":     "text/xml",
+		"start":    "<" + mtomRootID + ">",
+		"boundary": w.Boundary(),
+	}
+	if mtom {
+		params["type"] = "application/xop+xml"
+		params["start-info"] = startInfo
+	}
+	return buf.Bytes(), mime.FormatMediaType("multipart/related", params), nil
+}
+
+func attachmentID(n int) string {
+	return strconv.Itoa(n) + ".binary@gowhistler"
+}
+
+// unpackMultipart returns the envelope of a multipart/related message, with its xop:Include elements
+// replaced by the base64 encoding of the attachments they refer to, and the other attachments. Other
+// messages are returned as they are.
+func unpackMultipart(contentType string, body []byte) ([]byte, []Attachment, error) {
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/related" {
+		return body, nil, nil
+	}
+
+	type mimePart struct {
+		id, contentType string
+		data            Binary
+	}
+
+	start := strings.Trim(params["start"], "<>")
+	var root []byte
+	var parts []mimePart
+
+	r := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+
+		var reader io.Reader = part
+		if strings.EqualFold(part.Header.Get("Content-Transfer-Encoding"), "base64") {
+			reader = base64.NewDecoder(base64.StdEncoding, part)
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+
+		id := strings.Trim(part.Header.Get("Content-ID"), "<>")
+		if root == nil && (start == "" || id == start) {
+			root = data
+			continue
+		}
+		parts = append(parts, mimePart{id: id, contentType: part.Header.Get("Content-Type"), data: data})
+	}
+	if root == nil {
+		return nil, nil, errors.New("soap: multipart message has no root part")
+	}
+
+	included := make(map[string]bool)
+	if bytes.Contains(root, []byte(XOPNamespace)) {
+		doc := etree.NewDocument()
+		if err := doc.ReadFromBytes(root); err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		for _, include := range doc.FindElements("//Include") {
+			if include.NamespaceURI() != XOPNamespace {
+				continue
+			}
+
+			href := include.SelectAttrValue("href", "")
+			id, err := url.PathUnescape(strings.TrimPrefix(href, "cid:"))
+			if err != nil {
+				return nil, nil, errors.WithStack(err)
+			}
+			var data Binary
+			for _, part := range parts {
+				if part.id == id {
+					data = part.data
+				}
+			}
+			if data == nil {
+				return nil, nil, errors.Errorf("soap: attachment %v not found", href)
+			}
+			included[id] = true
+
+			parent := include.Parent()
+			parent.RemoveChild(include)
+			parent.SetText(base64.StdEncoding.EncodeToString(data))
+		}
+
+		if root, err = doc.WriteToBytes(); err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+	}
+
+	var attachments []Attachment
+	for _, part := range parts {
+		if included[part.id] {
+			continue
+		}
+		data := part.data
+		name := part.id
+		if i := strings.Index(name, "="); i >= 0 {
+			name = name[:i]
+		}
+		attachments = append(attachments, Attachment{Part: name, ContentType: part.contentType, Value: &data})
+	}
+
+	return root, attachments, nil
+}
+
+// setAttachments stores the received attachments in those of the envelope with the same part name
+func setAttachments(env *Envelope, received []Attachment) {
+	for _, attachment := range env.Attachments {
+		for _, r := range received {
+			if r.Part == attachment.Part && attachment.Value != nil {
+				*attachment.Value = *r.Value
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"github.com/stretchr/testify/require"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type document struct {
+	Name    string `xml:"name"`
+	Content Binary `xml:"content"`
+}
+
+func TestBinary(t *testing.T) {
+
+	data, err := xml.Marshal(&document{Name: "a", Content: Binary("hello")})
+	require.NoError(t, err)
+	require.Equal(t, `<document><name>a</name><content>aGVsbG8=</content></document>`, string(data))
+
+	doc := new(document)
+	require.NoError(t, xml.Unmarshal([]byte("<document><content>aGVs\n bG8=</content></document>"), doc))
+	require.Equal(t, "hello", string(doc.Content))
+}
+
+func TestMTOM(t *testing.T) {
+
+	op := Operation{
+		Name:     "Store",
+		Request:  xml.Name{Space: "urn:example:documents", Local: "Store"},
+		Response: xml.Name{Space: "urn:example:documents", Local: "StoreResponse"},
+	}
+	content := bytes.Repeat([]byte{0, 1, 2, 0xff}, 1000)
+
+	handler := NewHandler(Endpoint{
+		Operation: op,
+		Serve: func(ctx context.Context, decode func(*Envelope) error) (*Envelope, error) {
+			request := new(document)
+			if err := decode(&Envelope{Body: request}); err != nil {
+				return nil, err
+			}
+			return &Envelope{Body: &document{Name: request.Name + "-copy", Content: request.Content}}, nil
+		},
+	})
+	handler.MTOM = true
+
+	var contentType string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		require.NoError(t, err)
+		contentType = r.Header.Get("Content-Type")
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	client.MTOM = true
+	response := new(document)
+	require.NoError(t, client.Call(context.Background(), op, &Envelope{Body: &document{Name: "scan", Content: content}}, &Envelope{Body: response}))
+	require.Equal(t, "scan-copy", response.Name)
+	require.Equal(t, content, []byte(response.Content))
+
+	// the content went as a binary attachment referenced from the envelope
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	require.NoError(t, err)
+	require.Equal(t, "multipart/related", mediaType)
+	require.Equal(t, "application/xop+xml", params["type"])
+	require.Contains(t, string(body), `<content><xop:Include xmlns:xop="http://www.w3.org/2004/08/xop/include" href="cid:1.binary@gowhistler"/></content>`)
+	require.True(t, bytes.Contains(body, content))
+
+	// plain requests get MTOM responses too
+	response = new(document)
+	require.NoError(t, NewClient(server.URL).Call(context.Background(), op, &Envelope{Body: &document{Name: "scan", Content: content}}, &Envelope{Body: response}))
+	require.True(t, strings.HasPrefix(contentType, "text/xml"))
+	require.Equal(t, content, []byte(response.Content))
+}
+
+type labelledDocument struct {
+	Label   string `xml:"label"`
+	Content Binary `xml:"content"`
+}
+
+func TestMTOMPlainText(t *testing.T) {
+
+	// the label has the text of the encoded content, but only the content is moved
+	request := &labelledDocument{Label: "aGVsbG8=", Content: Binary("hello")}
+	payload, binaries, err := marshalXOP(xml.StartElement{Name: xml.Name{Local: "document"}}, &Envelope{Body: request})
+	require.NoError(t, err)
+	require.Contains(t, string(payload), `<label>aGVsbG8=</label><content>aGVsbG8=</content>`)
+
+	body, contentType, err := packMultipart(payload, true, binaries, nil)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `<label>aGVsbG8=</label><content><xop:Include xmlns:xop="http://www.w3.org/2004/08/xop/include" href="cid:1.binary@gowhistler"/></content>`)
+
+	payload, _, err = unpackMultipart(contentType, body)
+	require.NoError(t, err)
+	decoded := new(labelledDocument)
+	require.NoError(t, unmarshalEnvelope(bytes.NewReader(payload), &Envelope{Body: decoded}, nil))
+	require.Equal(t, request, decoded)
+}
+
+func TestUnpackMTOM(t *testing.T) {
+
+	body := "--MIME\r\n" +
+		"Content-Type: application/xop+xml; type=\"text/xml\"\r\n" +
+		"Content-ID: <root>\r\n\r\n" +
+		`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><document>` +
+		`<content><xop:Include xmlns:xop="http://www.w3.org/2004/08/xop/include" href="cid:scan%40example"/></content>` +
+		"</document></soap:Body></soap:Envelope>\r\n" +
+		"--MIME\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"Content-ID: <scan@example>\r\n\r\n" +
+		"aGVsbG8=\r\n" +
+		"--MIME--\r\n"
+
+	payload, _, err := unpackMultipart(`multipart/related; type="application/xop+xml"; start="<root>"; boundary=MIME`, []byte(body))
+	require.NoError(t, err)
+
+	doc := new(document)
+	require.NoError(t, unmarshalEnvelope(bytes.NewReader(payload), &Envelope{Body: doc}, nil))
+	require.Equal(t, "hello", string(doc.Content))
+
+	_, _, err = unpackMultipart(`multipart/related; boundary=MIME`, []byte(strings.Replace(body, "scan%40example", "missing", 1)))
+	require.ErrorContains(t, err, "not found")
+}
+
+func TestAttachments(t *testing.T) {
+
+	op := Operation{
+		Name:     "Store",
+		Request:  xml.Name{Space: "urn:example:documents", Local: "Store"},
+		Response: xml.Name{Space: "urn:example:documents", Local: "StoreResponse"},
+	}
+
+	var contentType string
+	handler := NewHandler(Endpoint{
+		Operation: op,
+		Serve: func(ctx context.Context, decode func(*Envelope) error) (*Envelope, error) {
+			request := new(document)
+			var photo Binary
+			if err := decode(&Envelope{Body: request, Attachments: []Attachment{{Part: "photo", Value: &photo}}}); err != nil {
+				return nil, err
+			}
+			thumbnail := Binary("small " + string(photo))
+			return &Envelope{
+				Body:        &document{Name: request.Name},
+				Attachments: []Attachment{{Part: "thumbnail", ContentType: "image/png", Value: &thumbnail}},
+			}, nil
+		},
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	photo, thumbnail := Binary("photo"), Binary(nil)
+	response := new(document)
+	err := NewClient(server.URL).Call(context.Background(), op,
+		&Envelope{Body: &document{Name: "holiday"}, Attachments: []Attachment{{Part: "photo", ContentType: "image/jpeg", Value: &photo}}},
+		&Envelope{Body: response, Attachments: []Attachment{{Part: "thumbnail", Value: &thumbnail}}})
+	require.NoError(t, err)
+	require.Equal(t, "holiday", response.Name)
+	require.Equal(t, "small photo", string(thumbnail))
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	require.NoError(t, err)
+	require.Equal(t, "multipart/related", mediaType)
+	require.Equal(t, "text/xml", params["type"])
+}
@@ -0,0 +1,286 @@
+package soap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/beevik/etree"
+	"github.com/keanpedersen/gowhistler/c14n"
+	"github.com/pkg/errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Recorder is a Doer recording the exchanges sent through it to files, or replaying them in tests. A request
+// is matched to a recording by its SOAPAction and its normalized body, the soap:Body canonicalized without the
+// wsu:Id given to it by signatures, so headers like timestamps and message ids may differ between runs. The
+// wsa:RelatesTo header of replayed responses is set to the message id of the new request, unless the response is
+// signed as changing it would break the signature.
+type Recorder struct {
+	// Dir holds the recordings, one file per exchange
+	Dir string
+
+	// Replay answers requests from the recordings without sending them, failing on requests not recorded
+	Replay bool
+
+	// HTTPClient sends the requests while recording, an *http.Client with DefaultTimeout if nil
+	HTTPClient Doer
+
+	// MaxResponseSize limits the size of recorded response bodies, DefaultMaxResponseSize if zero
+	MaxResponseSize int64
+}
+
+// recording is the file format of an exchange. The bodies are kept as bytes, written as base64, as multipart
+// bodies hold binary attachments JSON strings can not carry.
+type recording struct {
+	Action      string `json:"action"`
+	Request     []byte `json:"request"`
+	MessageID   string `json:"messageId,omitempty"`
+	StatusCode  int    `json:"statusCode"`
+	ContentType string `json:"contentType"`
+	Response    []byte `json:"response"`
+}
+
+func (r *Recorder) Do(req *http.Request) (*http.Response, error) {
+
+	var payload []byte
+	if req.Body != nil {
+		var err error
+		payload, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	action := req.Header.Get("SOAPAction")
+	name, messageID, err := recordingName(action, req.Header.Get("Content-Type"), payload)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(r.Dir, name)
+
+	if r.Replay {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("soap: no recorded response to %v request in %v", action, path)
+		}
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		var rec recording
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, errors.Wrapf(err, "soap: reading %v", path)
+		}
+		response := rec.Response
+		if rec.MessageID != "" && messageID != "" {
+			if response, err = relateResponse(rec.ContentType, response, messageID); err != nil {
+				return nil, errors.Wrapf(err, "soap: replaying %v", path)
+			}
+		}
+		return recordedResponse(req, rec.StatusCode, rec.ContentType, response), nil
+	}
+
+	var client Doer = defaultHTTPClient
+	if r.HTTPClient != nil {
+		client = r.HTTPClient
+	}
+	req.Body = io.NopCloser(bytes.NewReader(payload))
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	maxSize := r.MaxResponseSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxResponseSize
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if int64(len(body)) > maxSize {
+		return nil, errors.Errorf("soap: response to %v request exceeds %v bytes", action, maxSize)
+	}
+
+	rec := recording{
+		Action:      action,
+		Request:     payload,
+		MessageID:   messageID,
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Response:    body,
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := os.MkdirAll(r.Dir, 0755); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return recordedResponse(req, rec.StatusCode, rec.ContentType, body), nil
+}
+
+func recordedResponse(req *http.Request, statusCode int, contentType string, body []byte) *http.Response {
+	return &http.Response{
+		Status:        strconv.Itoa(statusCode) + " " + http.StatusText(statusCode),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {contentType}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// relateResponse sets the wsa:RelatesTo header of a recorded response to messageID. Responses without the header
+// and signed responses are returned unchanged. Of multipart responses the root part is changed.
+func relateResponse(contentType string, response []byte, messageID string) ([]byte, error) {
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err == nil && mediaType == "multipart/related" {
+		return rewriteRootPart(params, response, func(root []byte) ([]byte, error) {
+			return relateResponse("text/xml", root, messageID)
+		})
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(response); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	envelope := doc.Root()
+	if envelope == nil || envelope.Tag != "Envelope" || envelope.NamespaceURI() != EnvelopeNamespace {
+		// faults of the transport and the like are replayed as they are
+		return response, nil
+	}
+	header := findChild(envelope, EnvelopeNamespace, "Header")
+	if header == nil {
+		return response, nil
+	}
+	if security := findChild(header, WSSENamespace, "Security"); security != nil && findChild(security, DSigNamespace, "Signature") != nil {
+		return response, nil
+	}
+	relatesTo := findChild(header, AddressingNamespace, "RelatesTo")
+	if relatesTo == nil {
+		return response, nil
+	}
+
+	relatesTo.SetText(messageID)
+	ret, err := doc.WriteToBytes()
+	return ret, errors.WithStack(err)
+}
+
+// rewriteRootPart returns a multipart/related message with its root part changed by rewrite, keeping the
+// boundary and the headers of the parts
+func rewriteRootPart(params map[string]string, message []byte, rewrite func([]byte) ([]byte, error)) ([]byte, error) {
+
+	start := strings.Trim(params["start"], "<>")
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+	if err := w.SetBoundary(params["boundary"]); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	rootFound := false
+	r := multipart.NewReader(bytes.NewReader(message), params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		id := strings.Trim(part.Header.Get("Content-ID"), "<>")
+		if !rootFound && (start == "" || id == start) {
+			rootFound = true
+			if data, err = rewrite(data); err != nil {
+				return nil, err
+			}
+		}
+
+		copied, err := w.CreatePart(part.Header)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if _, err := copied.Write(data); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// recordingName names the file of an exchange by the operation and a hash of the normalized body, and returns
+// the WS-Addressing message id of the request if it has one
+func recordingName(action, contentType string, payload []byte) (string, string, error) {
+
+	root, _, err := unpackMultipart(contentType, payload)
+	if err != nil {
+		return "", "", err
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(root); err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	envelope := doc.Root()
+	if envelope == nil || envelope.Tag != "Envelope" || envelope.NamespaceURI() != EnvelopeNamespace {
+		return "", "", errors.New("soap: request is not a SOAP envelope")
+	}
+	body := findChild(envelope, EnvelopeNamespace, "Body")
+	if body == nil {
+		return "", "", errors.New("soap: no body found in envelope")
+	}
+
+	var messageID string
+	if header := findChild(envelope, EnvelopeNamespace, "Header"); header != nil {
+		if elm := findChild(header, AddressingNamespace, "MessageID"); elm != nil {
+			messageID = elm.Text()
+		}
+	}
+
+	for _, attr := range append([]etree.Attr{}, body.Attr...) {
+		if attr.Key == "Id" && attr.Space != "" && lookupNamespace(body, attr.Space) == WSUNamespace {
+			body.RemoveAttr(attr.FullKey())
+		}
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(action))
+	hash.Write([]byte{0})
+	hash.Write(c14n.Exclusive(body, nil))
+
+	operation := strings.Trim(action, `"`)
+	if i := strings.LastIndexAny(operation, "/:#"); i >= 0 {
+		operation = operation[i+1:]
+	}
+	operation = strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '.' || ('0' <= r && r <= '9') || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') {
+			return r
+		}
+		return -1
+	}, operation)
+
+	return operation + "-" + hex.EncodeToString(hash.Sum(nil)[:8]) + ".json", messageID, nil
+}
@@ -0,0 +1,138 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+
+	op := Operation{
+		Name:         "GetQuote",
+		Action:       "urn:example:quotes:GetQuote",
+		Request:      xml.Name{Space: "urn:example:quotes", Local: "GetQuote"},
+		Response:     xml.Name{Space: "urn:example:quotes", Local: "GetQuoteResponse"},
+		Addressing:   true,
+		InputAction:  "urn:example:quotes:GetQuote",
+		OutputAction: "urn:example:quotes:GetQuoteResponse",
+	}
+	handler := NewHandler(Endpoint{
+		Operation: op,
+		Serve: func(ctx context.Context, decode func(*Envelope) error) (*Envelope, error) {
+			request := new(quoteRequest)
+			if err := decode(&Envelope{Body: request}); err != nil {
+				return nil, err
+			}
+			return &Envelope{Body: &quoteResponse{Price: request.Symbol + "=1"}}, nil
+		},
+	})
+	server := httptest.NewServer(handler)
+
+	// the signature gives the body a new wsu:Id and the timestamp changes with every request
+	key, cert := testCertificate(t, "client")
+	dir := t.TempDir()
+	recorder := &Recorder{Dir: dir}
+	client := NewClient(server.URL, WithHTTPClient(recorder))
+	client.EnvelopeHandlers = []EnvelopeHandler{&Signer{Key: key, Certificate: cert}}
+
+	response := &quoteResponse{}
+	require.NoError(t, client.Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, &Envelope{Body: response}))
+	require.Equal(t, "ACME=1", response.Price)
+	files, err := filepath.Glob(filepath.Join(dir, "GetQuote-*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	server.Close()
+
+	recorder.Replay = true
+	response = &quoteResponse{}
+	require.NoError(t, client.Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, &Envelope{Body: response}))
+	require.Equal(t, "ACME=1", response.Price)
+
+	err = client.Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "OTHER"}}, &Envelope{Body: &quoteResponse{}})
+	require.ErrorContains(t, err, "no recorded response")
+
+	require.NoError(t, os.Remove(files[0]))
+	err = client.Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, &Envelope{Body: &quoteResponse{}})
+	require.ErrorContains(t, err, "no recorded response")
+}
+
+func TestRelateResponse(t *testing.T) {
+
+	response := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:wsa="http://www.w3.org/2005/08/addressing">` +
+		`<soap:Header><wsa:RelatesTo>urn:uuid:old</wsa:RelatesTo></soap:Header>` +
+		`<soap:Body><echo>urn:uuid:old</echo></soap:Body></soap:Envelope>`
+
+	// only the header changes, not the same text elsewhere
+	related, err := relateResponse("text/xml", []byte(response), "urn:uuid:new")
+	require.NoError(t, err)
+	require.Contains(t, string(related), `<wsa:RelatesTo>urn:uuid:new</wsa:RelatesTo>`)
+	require.Contains(t, string(related), `<echo>urn:uuid:old</echo>`)
+
+	signed := strings.Replace(response, `</soap:Header>`, `<wsse:Security xmlns:wsse="`+WSSENamespace+`">`+
+		`<ds:Signature xmlns:ds="`+DSigNamespace+`"/></wsse:Security></soap:Header>`, 1)
+	related, err = relateResponse("text/xml", []byte(signed), "urn:uuid:new")
+	require.NoError(t, err)
+	require.Equal(t, signed, string(related))
+}
+
+func TestRecorderMaxResponseSize(t *testing.T) {
+
+	op := Operation{
+		Name:     "GetQuote",
+		Action:   "urn:example:quotes:GetQuote",
+		Request:  xml.Name{Space: "urn:example:quotes", Local: "GetQuote"},
+		Response: xml.Name{Space: "urn:example:quotes", Local: "GetQuoteResponse"},
+	}
+	server := httptest.NewServer(NewHandler(Endpoint{
+		Operation: op,
+		Serve: func(ctx context.Context, decode func(*Envelope) error) (*Envelope, error) {
+			return &Envelope{Body: &quoteResponse{Price: strings.Repeat("9", 1000)}}, nil
+		},
+	}))
+	defer server.Close()
+
+	recorder := &Recorder{Dir: t.TempDir(), MaxResponseSize: 100}
+	err := NewClient(server.URL, WithHTTPClient(recorder)).Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, &Envelope{Body: &quoteResponse{}})
+	require.ErrorContains(t, err, "exceeds 100 bytes")
+}
+
+func TestRecorderAttachments(t *testing.T) {
+
+	op := Operation{
+		Name:     "Store",
+		Action:   "urn:example:documents:Store",
+		Request:  xml.Name{Space: "urn:example:documents", Local: "Store"},
+		Response: xml.Name{Space: "urn:example:documents", Local: "StoreResponse"},
+	}
+	// not valid UTF-8, which JSON strings would replace
+	image := Binary{0x89, 'P', 'N', 'G', 0xff, 0xfe, 0x00, 0x80}
+	server := httptest.NewServer(NewHandler(Endpoint{
+		Operation: op,
+		Serve: func(ctx context.Context, decode func(*Envelope) error) (*Envelope, error) {
+			return &Envelope{
+				Body:        &document{Name: "holiday"},
+				Attachments: []Attachment{{Part: "thumbnail", ContentType: "image/png", Value: &image}},
+			}, nil
+		},
+	}))
+
+	recorder := &Recorder{Dir: t.TempDir()}
+	client := NewClient(server.URL, WithHTTPClient(recorder))
+	call := func() Binary {
+		var thumbnail Binary
+		response := &Envelope{Body: new(document), Attachments: []Attachment{{Part: "thumbnail", Value: &thumbnail}}}
+		require.NoError(t, client.Call(context.Background(), op, &Envelope{Body: &document{Name: "holiday"}}, response))
+		return thumbnail
+	}
+	require.Equal(t, image, call())
+	server.Close()
+
+	recorder.Replay = true
+	require.Equal(t, image, call())
+}
@@ -0,0 +1,219 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"github.com/pkg/errors"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// DefaultMaxRequestSize is the default limit on the size of request bodies accepted by a Handler
+const DefaultMaxRequestSize = 10 << 20
+
+// Endpoint binds an operation to the generated function serving it
+type Endpoint struct {
+	Operation Operation
+	// Serve decodes the request envelope with decode, calls the server and returns the response envelope
+	Serve func(ctx context.Context, decode func(request *Envelope) error) (*Envelope, error)
+}
+
+// Handler is an http.Handler dispatching SOAP requests to the endpoints of a generated server. The endpoint is
+// found by the SOAPAction header, or by the element in the SOAP body if the action is missing or ambiguous.
+type Handler struct {
+	Endpoints []Endpoint
+
+	// MaxRequestSize limits the size of request bodies, DefaultMaxRequestSize if zero
+	MaxRequestSize int64
+
+	// Documents are served on GET requests, the WSDL with ?wsdl and the schemas with ?xsd=N
+	Documents []Document
+
+	// Verifier checks the signature of requests, the certificate is available from VerifiedCertificate
+	Verifier *Verifier
+
+	// MTOM sends the Binary values of responses as MTOM/XOP attachments. MTOM requests are always accepted.
+	MTOM bool
+}
+
+func NewHandler(endpoints ...Endpoint) *Handler {
+	return &Handler{
+		Endpoints:      endpoints,
+		MaxRequestSize: DefaultMaxRequestSize,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method == http.MethodGet && len(h.Documents) > 0 {
+		h.serveDocument(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "SOAP requests must be posted", http.StatusMethodNotAllowed)
+		return
+	}
+
+	maxSize := h.MaxRequestSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxRequestSize
+	}
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSize))
+	if err != nil {
+		writeFault(w, &Fault{Code: "soap:Client", String: "Could not read request: " + err.Error()}, xml.Name{}, nil)
+		return
+	}
+	payload, attachments, err := unpackMultipart(r.Header.Get("Content-Type"), payload)
+	if err != nil {
+		writeFault(w, &Fault{Code: "soap:Client", String: "Could not read request: " + err.Error()}, xml.Name{}, nil)
+		return
+	}
+
+	ctx := r.Context()
+	if h.Verifier != nil {
+		cert, err := verifyPayload(h.Verifier, payload)
+		if err != nil {
+			writeFault(w, &Fault{Code: "soap:Client", String: "Security verification failed: " + err.Error()}, xml.Name{}, nil)
+			return
+		}
+		ctx = context.WithValue(ctx, certificateKey{}, cert)
+	}
+
+	endpoint, err := h.findEndpoint(r, payload)
+	if err != nil {
+		writeFault(w, &Fault{Code: "soap:Client", String: err.Error()}, xml.Name{}, nil)
+		return
+	}
+
+	var decodeErr error
+	messageID := new(string)
+	decode := func(request *Envelope) error {
+		if endpoint.Operation.Addressing {
+			request, messageID = addressingHeader(request, "MessageID")
+		}
+		decodeErr = unmarshalEnvelope(bytes.NewReader(payload), request, nil)
+		setAttachments(request, attachments)
+		return decodeErr
+	}
+
+	response, err := endpoint.Serve(ctx, decode)
+	if err != nil {
+		if decodeErr != nil {
+			writeFault(w, &Fault{Code: "soap:Client", String: "Could not decode request: " + decodeErr.Error()}, xml.Name{}, nil)
+			return
+		}
+		writeError(w, endpoint.Operation, err)
+		return
+	}
+
+	if endpoint.Operation.Addressing && *messageID != "" {
+		response = addressReply(endpoint.Operation, *messageID, response)
+	}
+
+	var body []byte
+	var binaries []xopBinary
+	if h.MTOM {
+		body, binaries, err = marshalXOP(prefixedElement(endpoint.Operation.Response), response)
+	} else {
+		body, err = marshalEnvelope(prefixedElement(endpoint.Operation.Response), response)
+	}
+	if err != nil {
+		writeError(w, endpoint.Operation, err)
+		return
+	}
+
+	contentType := "text/xml; charset=utf-8"
+	if h.MTOM || len(response.Attachments) > 0 {
+		body, contentType, err = packMultipart(body, h.MTOM, binaries, response.Attachments)
+		if err != nil {
+			writeError(w, endpoint.Operation, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+func (h *Handler) findEndpoint(r *http.Request, payload []byte) (*Endpoint, error) {
+
+	candidates := h.Endpoints
+
+	action := strings.Trim(r.Header.Get("SOAPAction"), `"`)
+	if action != "" {
+		var matches []Endpoint
+		for _, endpoint := range h.Endpoints {
+			if endpoint.Operation.Action == action {
+				matches = append(matches, endpoint)
+			}
+		}
+		if len(matches) == 1 {
+			return &matches[0], nil
+		}
+		if len(matches) > 1 {
+			candidates = matches
+		}
+	}
+
+	name, err := bodyElement(bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	for i := range candidates {
+		if candidates[i].Operation.Request == name {
+			return &candidates[i], nil
+		}
+	}
+
+	return nil, errors.Errorf("No operation found for SOAPAction %q and body element %v", action, name.Local)
+}
+
+// writeError sends the error as a fault. Typed errors of the operation's faults are sent with their detail,
+// errors that are not faults are logged and hidden from the caller.
+func writeError(w http.ResponseWriter, op Operation, err error) {
+
+	var detailErr DetailError
+	if errors.As(err, &detailErr) {
+		for _, faultType := range op.Faults {
+			if reflect.TypeOf(faultType.New(&Fault{})) != reflect.TypeOf(detailErr) {
+				continue
+			}
+
+			var fault *Fault
+			if !errors.As(detailErr, &fault) || fault == nil {
+				fault = &Fault{Code: "soap:Server", String: detailErr.Error()}
+			}
+			writeFault(w, fault, faultType.Detail, detailErr.FaultDetail())
+			return
+		}
+	}
+
+	var fault *Fault
+	if errors.As(err, &fault) && fault != nil {
+		writeFault(w, fault, xml.Name{}, nil)
+		return
+	}
+
+	log.Printf("soap: %v failed: %+v\n", op.Name, err)
+	writeFault(w, &Fault{Code: "soap:Server", String: "Internal server error"}, xml.Name{}, nil)
+}
+
+func writeFault(w http.ResponseWriter, fault *Fault, name xml.Name, detail interface{}) {
+
+	body, err := marshalFault(fault, name, detail)
+	if err != nil {
+		log.Printf("soap: could not encode fault: %+v\n", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write(body)
+}
@@ -0,0 +1,141 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+
+	op := Operation{
+		Name:     "GetQuote",
+		Action:   "urn:example:quotes:GetQuote",
+		Request:  xml.Name{Space: "urn:example:quotes", Local: "GetQuote"},
+		Response: xml.Name{Space: "urn:example:quotes", Local: "GetQuoteResponse"},
+		Faults: []FaultType{{
+			Detail: xml.Name{Space: "urn:example:quotes", Local: "NotFound"},
+			New: func(fault *Fault) DetailError {
+				return &notFoundError{Fault: fault, Detail: new(trace)}
+			},
+		}},
+	}
+	other := Operation{
+		Name:    "Other",
+		Action:  "urn:example:quotes:Other",
+		Request: xml.Name{Space: "urn:example:quotes", Local: "Other"},
+	}
+
+	handler := NewHandler(
+		Endpoint{
+			Operation: other,
+			Serve: func(ctx context.Context, decode func(*Envelope) error) (*Envelope, error) {
+				t.Fatal("dispatched to the wrong operation")
+				return nil, nil
+			},
+		},
+		Endpoint{
+			Operation: op,
+			Serve: func(ctx context.Context, decode func(*Envelope) error) (*Envelope, error) {
+				request := new(quoteRequest)
+				if err := decode(&Envelope{Body: request}); err != nil {
+					return nil, err
+				}
+				if request.Symbol == "NONE" {
+					return nil, &notFoundError{Detail: &trace{ID: request.Symbol}}
+				}
+				return &Envelope{Body: &quoteResponse{Price: request.Symbol + "=1"}}, nil
+			},
+		},
+	)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	response := &quoteResponse{}
+	err := NewClient(server.URL).Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, &Envelope{Body: response})
+	require.NoError(t, err)
+	require.Equal(t, "ACME=1", response.Price)
+
+	// without SOAPAction the body element decides
+	response = &quoteResponse{}
+	err = NewClient(server.URL).Call(context.Background(), Operation{Request: op.Request}, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, &Envelope{Body: response})
+	require.NoError(t, err)
+	require.Equal(t, "ACME=1", response.Price)
+
+	err = NewClient(server.URL).Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "NONE"}}, &Envelope{Body: response})
+	var notFound *notFoundError
+	require.ErrorAs(t, err, &notFound)
+	require.Equal(t, "NONE", notFound.Detail.ID)
+	require.Equal(t, "soap:Server", notFound.Fault.Code)
+}
+
+func TestHandlerMaxRequestSize(t *testing.T) {
+
+	op := Operation{
+		Name:     "GetQuote",
+		Action:   "urn:example:quotes:GetQuote",
+		Request:  xml.Name{Space: "urn:example:quotes", Local: "GetQuote"},
+		Response: xml.Name{Space: "urn:example:quotes", Local: "GetQuoteResponse"},
+	}
+	endpoint := Endpoint{
+		Operation: op,
+		Serve: func(ctx context.Context, decode func(*Envelope) error) (*Envelope, error) {
+			request := new(quoteRequest)
+			if err := decode(&Envelope{Body: request}); err != nil {
+				return nil, err
+			}
+			return &Envelope{Body: &quoteResponse{Price: request.Symbol + "=1"}}, nil
+		},
+	}
+
+	// a Handler without a limit uses DefaultMaxRequestSize
+	server := httptest.NewServer(&Handler{Endpoints: []Endpoint{endpoint}})
+	defer server.Close()
+	response := &quoteResponse{}
+	require.NoError(t, NewClient(server.URL).Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, &Envelope{Body: response}))
+	require.Equal(t, "ACME=1", response.Price)
+
+	limited := httptest.NewServer(&Handler{Endpoints: []Endpoint{endpoint}, MaxRequestSize: 10})
+	defer limited.Close()
+	err := NewClient(limited.URL).Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, &Envelope{Body: response})
+	require.ErrorContains(t, err, "Could not read request")
+}
+
+func TestHandlerDocuments(t *testing.T) {
+
+	handler := NewHandler()
+	handler.Documents = []Document{
+		{Location: "service.wsdl", Content: `<wsdl:definitions xmlns:wsdl="http://schemas.xmlsoap.org/wsdl/" xmlns:soap="http://schemas.xmlsoap.org/wsdl/soap/" xmlns:xs="http://www.w3.org/2001/XMLSchema">` +
+			`<wsdl:types><xs:schema><xs:import namespace="urn:common" schemaLocation="common.xsd"/></xs:schema></wsdl:types>` +
+			`<wsdl:service name="S"><wsdl:port name="P"><soap:address location="http://partner.example/service"/></wsdl:port></wsdl:service>` +
+			`</wsdl:definitions>`},
+		{Location: "common.xsd", Content: `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" targetNamespace="urn:common"/>`},
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	get := func(query string) (int, string) {
+		resp, err := http.Get(server.URL + "/service" + query)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := get("?wsdl")
+	require.Equal(t, http.StatusOK, status)
+	require.Contains(t, body, `schemaLocation="`+server.URL+`/service?xsd=1"`)
+	require.Contains(t, body, `<soap:address location="`+server.URL+`/service"/>`)
+
+	status, body = get("?xsd=1")
+	require.Equal(t, http.StatusOK, status)
+	require.Contains(t, body, `targetNamespace="urn:common"`)
+
+	status, _ = get("?xsd=2")
+	require.Equal(t, http.StatusNotFound, status)
+}
@@ -0,0 +1,187 @@
+package soap
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"github.com/beevik/etree"
+	"github.com/keanpedersen/gowhistler/c14n"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Namespaces and algorithms of XML digital signatures
+const (
+	DSigNamespace = "http://www.w3.org/2000/09/xmldsig#"
+
+	ExcC14N   = c14n.ExclusiveAlgorithm
+	RSASHA256 = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	SHA256    = "http://www.w3.org/2001/04/xmlenc#sha256"
+	X509v3    = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-x509-token-profile-1.0#X509v3"
+)
+
+// DefaultExpiry is the lifetime of timestamps added by a Signer
+const DefaultExpiry = 5 * time.Minute
+
+// KeyInfoType selects how a Signer refers to its certificate
+type KeyInfoType int
+
+const (
+	// KeyInfoSecurityToken puts the certificate in a wsse:BinarySecurityToken referenced from ds:KeyInfo
+	KeyInfoSecurityToken KeyInfoType = iota
+	// KeyInfoX509Data puts the certificate in ds:KeyInfo/ds:X509Data
+	KeyInfoX509Data
+)
+
+// Signer is an EnvelopeHandler signing requests with an X.509 certificate. It adds a wsu:Timestamp to the
+// wsse:Security header and signs it together with the Body and the chosen headers, using exclusive
+// canonicalization and RSA-SHA256.
+type Signer struct {
+	Key         crypto.Signer
+	Certificate *x509.Certificate
+
+	// Headers are the header blocks signed besides the Body and Timestamp
+	Headers []xml.Name
+
+	KeyInfo KeyInfoType
+
+	// Expiry is the lifetime of the timestamp, DefaultExpiry if zero
+	Expiry time.Duration
+
+	// Now returns the creation time of timestamps, time.Now if nil
+	Now func() time.Time
+}
+
+func (s *Signer) HandleRequest(op Operation, envelope *etree.Document) error {
+
+	if s.Key == nil || s.Certificate == nil {
+		return errors.New("soap: signer needs a key and a certificate")
+	}
+
+	security, err := SecurityHeader(envelope)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	expiry := s.Expiry
+	if expiry == 0 {
+		expiry = DefaultExpiry
+	}
+
+	created := now().UTC()
+	timestamp := etree.NewElement("wsu:Timestamp")
+	security.InsertChildAt(0, timestamp)
+	timestamp.CreateElement("wsu:Created").SetText(created.Format(time.RFC3339))
+	timestamp.CreateElement("wsu:Expires").SetText(created.Add(expiry).Format(time.RFC3339))
+
+	signed := []*etree.Element{findChild(envelope.Root(), EnvelopeNamespace, "Body"), timestamp}
+	header := security.Parent()
+	for _, name := range s.Headers {
+		for _, child := range header.ChildElements() {
+			if child.Tag == name.Local && child.NamespaceURI() == name.Space {
+				signed = append(signed, child)
+			}
+		}
+	}
+
+	// the ids must be in place before anything is digested
+	var ids []string
+	for _, elm := range signed {
+		if elm == nil {
+			return errors.New("soap: envelope has no body to sign")
+		}
+		id, err := wsuID(elm)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+
+	var tokenID string
+	if s.KeyInfo == KeyInfoSecurityToken {
+		tokenID, err = newID("X509")
+		if err != nil {
+			return err
+		}
+		token := etree.NewElement("wsse:BinarySecurityToken")
+		security.InsertChildAt(timestamp.Index()+1, token)
+		token.CreateAttr("EncodingType", Base64Binary)
+		token.CreateAttr("ValueType", X509v3)
+		token.CreateAttr("wsu:Id", tokenID)
+		token.SetText(base64.StdEncoding.EncodeToString(s.Certificate.Raw))
+	}
+
+	signature := security.CreateElement("ds:Signature")
+	signature.CreateAttr("xmlns:ds", DSigNamespace)
+
+	signedInfo := signature.CreateElement("ds:SignedInfo")
+	signedInfo.CreateElement("ds:CanonicalizationMethod").CreateAttr("Algorithm", ExcC14N)
+	signedInfo.CreateElement("ds:SignatureMethod").CreateAttr("Algorithm", RSASHA256)
+	for i, elm := range signed {
+		digest := sha256.Sum256(c14n.Exclusive(elm, nil))
+
+		reference := signedInfo.CreateElement("ds:Reference")
+		reference.CreateAttr("URI", "#"+ids[i])
+		reference.CreateElement("ds:Transforms").CreateElement("ds:Transform").CreateAttr("Algorithm", ExcC14N)
+		reference.CreateElement("ds:DigestMethod").CreateAttr("Algorithm", SHA256)
+		reference.CreateElement("ds:DigestValue").SetText(base64.StdEncoding.EncodeToString(digest[:]))
+	}
+
+	digest := sha256.Sum256(c14n.Exclusive(signedInfo, nil))
+	value, err := s.Key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	signature.CreateElement("ds:SignatureValue").SetText(base64.StdEncoding.EncodeToString(value))
+
+	keyInfo := signature.CreateElement("ds:KeyInfo")
+	switch s.KeyInfo {
+	case KeyInfoSecurityToken:
+		reference := keyInfo.CreateElement("wsse:SecurityTokenReference").CreateElement("wsse:Reference")
+		reference.CreateAttr("URI", "#"+tokenID)
+		reference.CreateAttr("ValueType", X509v3)
+	case KeyInfoX509Data:
+		keyInfo.CreateElement("ds:X509Data").CreateElement("ds:X509Certificate").SetText(base64.StdEncoding.EncodeToString(s.Certificate.Raw))
+	default:
+		return errors.Errorf("soap: unknown key info type %v", s.KeyInfo)
+	}
+
+	return nil
+}
+
+// wsuID returns the wsu:Id of the element, giving it one if it has none
+func wsuID(elm *etree.Element) (string, error) {
+
+	for _, attr := range elm.Attr {
+		if attr.Key == "Id" && attr.Space != "" && lookupNamespace(elm, attr.Space) == WSUNamespace {
+			return attr.Value, nil
+		}
+	}
+
+	id, err := newID("id")
+	if err != nil {
+		return "", err
+	}
+	if lookupNamespace(elm, "wsu") != WSUNamespace {
+		elm.CreateAttr("xmlns:wsu", WSUNamespace)
+	}
+	elm.CreateAttr("wsu:Id", id)
+
+	return id, nil
+}
+
+func newID(prefix string) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return prefix + "-" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,86 @@
+package soap
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"github.com/keanpedersen/gowhistler/c14n"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testCertificate creates a self signed certificate for signing tests
+func testCertificate(t *testing.T, name string) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return key, cert
+}
+
+func TestSigner(t *testing.T) {
+
+	key, cert := testCertificate(t, "client")
+	traceName := xml.Name{Space: "urn:example:trace", Local: "Trace"}
+	op := Operation{Name: "GetQuote", Request: xml.Name{Space: "urn:example:quotes", Local: "GetQuote"}}
+
+	for _, keyInfo := range []KeyInfoType{KeyInfoSecurityToken, KeyInfoX509Data} {
+		client := NewClient("")
+		client.EnvelopeHandlers = []EnvelopeHandler{&Signer{Key: key, Certificate: cert, Headers: []xml.Name{traceName}, KeyInfo: keyInfo}}
+		doc := captureRequest(t, client, op, &Envelope{
+			Headers: []Header{{Name: traceName, Value: &trace{ID: "1"}}},
+			Body:    &quoteRequest{Symbol: "ACME"},
+		})
+
+		signedInfo := doc.FindElement("//Security/Signature/SignedInfo")
+		require.NotNil(t, signedInfo)
+
+		references := signedInfo.SelectElements("Reference")
+		require.Len(t, references, 3)
+		for i, path := range []string{"//Body", "//Security/Timestamp", "//Header/Trace"} {
+			elm := doc.FindElement(path)
+			require.Equal(t, "#"+elm.SelectAttrValue("wsu:Id", ""), references[i].SelectAttrValue("URI", ""), path)
+
+			digest := sha256.Sum256(c14n.Exclusive(elm, nil))
+			require.Equal(t, base64.StdEncoding.EncodeToString(digest[:]), references[i].SelectElement("DigestValue").Text(), path)
+		}
+
+		value, err := base64.StdEncoding.DecodeString(doc.FindElement("//Signature/SignatureValue").Text())
+		require.NoError(t, err)
+		digest := sha256.Sum256(c14n.Exclusive(signedInfo, nil))
+		require.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], value))
+
+		var certificate string
+		if keyInfo == KeyInfoSecurityToken {
+			token := doc.FindElement("//Security/BinarySecurityToken")
+			require.Equal(t, "#"+token.SelectAttrValue("wsu:Id", ""), doc.FindElement("//KeyInfo/SecurityTokenReference/Reference").SelectAttrValue("URI", ""))
+			certificate = token.Text()
+		} else {
+			certificate = doc.FindElement("//KeyInfo/X509Data/X509Certificate").Text()
+		}
+		require.Equal(t, base64.StdEncoding.EncodeToString(cert.Raw), certificate)
+	}
+}
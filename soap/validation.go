@@ -0,0 +1,67 @@
+package soap
+
+import (
+	"github.com/pkg/errors"
+	"reflect"
+	"strings"
+)
+
+// Validatable is implemented by the generated types, checking the restrictions of the schemas
+type Validatable interface {
+	Validate() error
+}
+
+// validateEnvelope validates the body and header values of an envelope implementing Validatable, following
+// pointers until a value does
+func validateEnvelope(envelope *Envelope) error {
+
+	values := []interface{}{envelope.Body}
+	for _, header := range envelope.Headers {
+		values = append(values, header.Value)
+	}
+
+	for _, value := range values {
+		v := reflect.ValueOf(value)
+		for v.IsValid() && !(v.Kind() == reflect.Ptr && v.IsNil()) {
+			if validatable, ok := v.Interface().(Validatable); ok {
+				if err := validatable.Validate(); err != nil {
+					return errors.Wrap(err, "soap: invalid request")
+				}
+				break
+			}
+			if v.Kind() != reflect.Ptr {
+				break
+			}
+			v = v.Elem()
+		}
+	}
+	return nil
+}
+
+// DecimalDigits counts the significant digits of a decimal, in total and after the decimal point, as limited
+// by the totalDigits and fractionDigits facets. ok is false when value is not a decimal.
+func DecimalDigits(value string) (total, fraction int, ok bool) {
+
+	value = strings.TrimLeft(strings.TrimSpace(value), "+-")
+	integer, decimals := value, ""
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		integer, decimals = value[:i], value[i+1:]
+	}
+	if integer == "" && decimals == "" {
+		return 0, 0, false
+	}
+	for _, r := range integer + decimals {
+		if r < '0' || r > '9' {
+			return 0, 0, false
+		}
+	}
+
+	integer = strings.TrimLeft(integer, "0")
+	decimals = strings.TrimRight(decimals, "0")
+	total = len(integer) + len(decimals)
+	if total == 0 {
+		// zero has a single digit
+		total = 1
+	}
+	return total, len(decimals), true
+}
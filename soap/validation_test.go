@@ -0,0 +1,27 @@
+package soap
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDecimalDigits(t *testing.T) {
+
+	for value, expected := range map[string][2]int{
+		"0":        {1, 0},
+		"123.45":   {5, 2},
+		"-007.500": {2, 1},
+		"+.25":     {2, 2},
+		"1000":     {4, 0},
+		" 12.0 ":   {2, 0},
+	} {
+		total, fraction, ok := DecimalDigits(value)
+		require.True(t, ok, value)
+		require.Equal(t, expected, [2]int{total, fraction}, value)
+	}
+
+	for _, value := range []string{"", ".", "1e5", "12a", "1.2.3"} {
+		_, _, ok := DecimalDigits(value)
+		require.False(t, ok, value)
+	}
+}
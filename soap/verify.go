@@ -0,0 +1,365 @@
+package soap
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"github.com/beevik/etree"
+	"github.com/keanpedersen/gowhistler/c14n"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// Verifier checks the XML signature of incoming envelopes, as made by a Signer. The Body, the Timestamp and
+// the chosen headers must be signed by a certificate chaining to one of the trusted roots, using SHA-256
+// digests and RSA-SHA256.
+type Verifier struct {
+	// Roots are the trusted certificates, and Intermediates optional certificates used to build chains to them.
+	// Roots is required, the system roots are never trusted.
+	Roots         *x509.CertPool
+	Intermediates *x509.CertPool
+
+	// Headers are the header blocks that must be signed when present, besides the Body and Timestamp
+	Headers []xml.Name
+
+	// RequireTimestamp rejects envelopes without a wsu:Timestamp
+	RequireTimestamp bool
+
+	// Now returns the time timestamps and certificates are checked against, time.Now if nil
+	Now func() time.Time
+}
+
+// Verify checks the signature of the envelope and returns the certificate that signed it
+func (v *Verifier) Verify(envelope *etree.Document) (*x509.Certificate, error) {
+
+	if v.Roots == nil {
+		return nil, errors.New("soap: verifier has no trusted roots")
+	}
+
+	root := envelope.Root()
+	if root == nil || root.Tag != "Envelope" || root.NamespaceURI() != EnvelopeNamespace {
+		return nil, errors.New("soap: document is not a SOAP envelope")
+	}
+	body, err := uniqueChild(root, EnvelopeNamespace, "Body")
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, errors.New("soap: envelope has no body")
+	}
+
+	var security, signature *etree.Element
+	header, err := uniqueChild(root, EnvelopeNamespace, "Header")
+	if err != nil {
+		return nil, err
+	}
+	if header != nil {
+		if security, err = uniqueChild(header, WSSENamespace, "Security"); err != nil {
+			return nil, err
+		}
+	}
+	if security != nil {
+		signature = findChild(security, DSigNamespace, "Signature")
+	}
+	if signature == nil {
+		return nil, errors.New("soap: envelope is not signed")
+	}
+
+	ids, err := indexIDs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	signedInfo := findChild(signature, DSigNamespace, "SignedInfo")
+	if signedInfo == nil {
+		return nil, errors.New("soap: signature has no SignedInfo")
+	}
+	canonicalization := findChild(signedInfo, DSigNamespace, "CanonicalizationMethod")
+	if canonicalization == nil {
+		return nil, errors.New("soap: signature has no CanonicalizationMethod")
+	}
+	if err := checkAlgorithm(signedInfo, "SignatureMethod", RSASHA256); err != nil {
+		return nil, err
+	}
+
+	// every reference must digest to the element carrying its id
+	signed := make(map[*etree.Element]bool)
+	for _, reference := range signedInfo.ChildElements() {
+		if reference.Tag != "Reference" || reference.NamespaceURI() != DSigNamespace {
+			continue
+		}
+
+		uri := reference.SelectAttrValue("URI", "")
+		elm, ok := ids[strings.TrimPrefix(uri, "#")]
+		if !strings.HasPrefix(uri, "#") || !ok {
+			return nil, errors.Errorf("soap: signature reference %v not found", uri)
+		}
+
+		// a single canonicalization transform, or none for the default inclusive canonicalization
+		var transform *etree.Element
+		if transforms := findChild(reference, DSigNamespace, "Transforms"); transforms != nil {
+			if len(transforms.ChildElements()) != 1 {
+				return nil, errors.Errorf("soap: unsupported transforms of %v", uri)
+			}
+			transform = transforms.ChildElements()[0]
+		}
+		canonical, err := canonicalForm(transform, elm)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkAlgorithm(reference, "DigestMethod", SHA256); err != nil {
+			return nil, err
+		}
+
+		digestValue := findChild(reference, DSigNamespace, "DigestValue")
+		if digestValue == nil {
+			return nil, errors.Errorf("soap: signature reference %v has no digest", uri)
+		}
+		expected, err := base64.StdEncoding.DecodeString(strings.TrimSpace(digestValue.Text()))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		digest := sha256.Sum256(canonical)
+		if string(expected) != string(digest[:]) {
+			return nil, errors.Errorf("soap: digest of %v does not match", uri)
+		}
+
+		signed[elm] = true
+	}
+
+	// the elements that matter must be the signed ones, not copies moved elsewhere in the envelope
+	if !signed[body] {
+		return nil, errors.New("soap: body is not signed")
+	}
+	timestamp := findChild(security, WSUNamespace, "Timestamp")
+	if timestamp == nil && v.RequireTimestamp {
+		return nil, errors.New("soap: envelope has no timestamp")
+	}
+	if timestamp != nil && !signed[timestamp] {
+		return nil, errors.New("soap: timestamp is not signed")
+	}
+	for _, name := range v.Headers {
+		for _, child := range header.ChildElements() {
+			if child.Tag == name.Local && child.NamespaceURI() == name.Space && !signed[child] {
+				return nil, errors.Errorf("soap: header %v is not signed", name.Local)
+			}
+		}
+	}
+
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+	if timestamp != nil {
+		if err := checkTimestamp(timestamp, now()); err != nil {
+			return nil, err
+		}
+	}
+
+	cert, err := signatureCertificate(signature, ids)
+	if err != nil {
+		return nil, err
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         v.Roots,
+		Intermediates: v.Intermediates,
+		CurrentTime:   now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "soap: signing certificate is not trusted")
+	}
+
+	signatureValue := findChild(signature, DSigNamespace, "SignatureValue")
+	if signatureValue == nil {
+		return nil, errors.New("soap: signature has no value")
+	}
+	value, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(signatureValue.Text()), ""))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("soap: signing certificate has no RSA key")
+	}
+	canonical, err := canonicalForm(canonicalization, signedInfo)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(canonical)
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], value); err != nil {
+		return nil, errors.Wrap(err, "soap: signature does not match")
+	}
+
+	return cert, nil
+}
+
+// uniqueChild returns the child element with the given namespace and name. Envelopes repeating it are
+// rejected, as the decoder could read an unsigned copy in place of the signed element.
+func uniqueChild(elm *etree.Element, space, tag string) (*etree.Element, error) {
+	var found *etree.Element
+	for _, child := range elm.ChildElements() {
+		if child.Tag == tag && child.NamespaceURI() == space {
+			if found != nil {
+				return nil, errors.Errorf("soap: envelope has more than one %v", tag)
+			}
+			found = child
+		}
+	}
+	return found, nil
+}
+
+// indexIDs maps the wsu:Id and Id attributes of the envelope to their elements. Duplicate ids are rejected,
+// as they allow a signed element to be swapped for another one.
+func indexIDs(root *etree.Element) (map[string]*etree.Element, error) {
+
+	ids := make(map[string]*etree.Element)
+
+	var walk func(elm *etree.Element) error
+	walk = func(elm *etree.Element) error {
+		for _, attr := range elm.Attr {
+			if attr.Key != "Id" || (attr.Space != "" && lookupNamespace(elm, attr.Space) != WSUNamespace) {
+				continue
+			}
+			if _, ok := ids[attr.Value]; ok {
+				return errors.Errorf("soap: duplicate id %v in envelope", attr.Value)
+			}
+			ids[attr.Value] = elm
+		}
+		for _, child := range elm.ChildElements() {
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return ids, walk(root)
+}
+
+func checkAlgorithm(parent *etree.Element, tag, algorithm string) error {
+	elm := findChild(parent, DSigNamespace, tag)
+	if elm == nil || elm.SelectAttrValue("Algorithm", "") != algorithm {
+		return errors.Errorf("soap: %v must be %v", tag, algorithm)
+	}
+	return nil
+}
+
+// canonicalForm canonicalizes elm by the algorithm of a ds:CanonicalizationMethod or ds:Transform, with the
+// PrefixList of its ec:InclusiveNamespaces. Without a method the inclusive algorithm is used.
+func canonicalForm(method, elm *etree.Element) ([]byte, error) {
+
+	if method == nil {
+		return c14n.Inclusive(elm), nil
+	}
+
+	var prefixList []string
+	if inclusive := findChild(method, c14n.ExclusiveNamespace, "InclusiveNamespaces"); inclusive != nil {
+		prefixList = c14n.PrefixList(inclusive.SelectAttrValue("PrefixList", ""))
+	}
+
+	switch algorithm := method.SelectAttrValue("Algorithm", ""); algorithm {
+	case c14n.ExclusiveAlgorithm:
+		return c14n.Exclusive(elm, prefixList), nil
+	case c14n.InclusiveAlgorithm:
+		return c14n.Inclusive(elm), nil
+	default:
+		return nil, errors.Errorf("soap: unsupported canonicalization %v", algorithm)
+	}
+}
+
+// clockSkew is how far in the future the creation time of a timestamp may be
+const clockSkew = 5 * time.Minute
+
+// checkTimestamp rejects timestamps which have expired or are created in the future
+func checkTimestamp(timestamp *etree.Element, now time.Time) error {
+
+	if created := findChild(timestamp, WSUNamespace, "Created"); created != nil {
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(created.Text()))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if t.After(now.Add(clockSkew)) {
+			return errors.Errorf("soap: timestamp created in the future at %v", t)
+		}
+	}
+
+	expires := findChild(timestamp, WSUNamespace, "Expires")
+	if expires == nil {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(expires.Text()))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if now.After(t) {
+		return errors.Errorf("soap: timestamp expired at %v", t)
+	}
+	return nil
+}
+
+// signatureCertificate finds the certificate of ds:KeyInfo, either directly in X509Data or in the
+// BinarySecurityToken referenced by a SecurityTokenReference
+func signatureCertificate(signature *etree.Element, ids map[string]*etree.Element) (*x509.Certificate, error) {
+
+	keyInfo := findChild(signature, DSigNamespace, "KeyInfo")
+	if keyInfo == nil {
+		return nil, errors.New("soap: signature has no KeyInfo")
+	}
+
+	var encoded string
+	if x509Data := findChild(keyInfo, DSigNamespace, "X509Data"); x509Data != nil {
+		certElm := findChild(x509Data, DSigNamespace, "X509Certificate")
+		if certElm == nil {
+			return nil, errors.New("soap: X509Data has no certificate")
+		}
+		encoded = certElm.Text()
+	} else if str := findChild(keyInfo, WSSENamespace, "SecurityTokenReference"); str != nil {
+		reference := findChild(str, WSSENamespace, "Reference")
+		if reference == nil {
+			return nil, errors.New("soap: SecurityTokenReference has no reference")
+		}
+		uri := reference.SelectAttrValue("URI", "")
+		token, ok := ids[strings.TrimPrefix(uri, "#")]
+		if !ok || token.Tag != "BinarySecurityToken" || token.NamespaceURI() != WSSENamespace {
+			return nil, errors.Errorf("soap: security token %v not found", uri)
+		}
+		encoded = token.Text()
+	} else {
+		return nil, errors.New("soap: KeyInfo holds no certificate")
+	}
+
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return cert, nil
+}
+
+type certificateKey struct{}
+
+// VerifiedCertificate returns the certificate that signed the request served with ctx, or nil if the
+// Handler has no Verifier
+func VerifiedCertificate(ctx context.Context) *x509.Certificate {
+	cert, _ := ctx.Value(certificateKey{}).(*x509.Certificate)
+	return cert
+}
+
+// verifyPayload parses and verifies an encoded envelope
+func verifyPayload(verifier *Verifier, payload []byte) (*x509.Certificate, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(payload); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return verifier.Verify(doc)
+}
@@ -0,0 +1,211 @@
+package soap
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/xml"
+	"github.com/beevik/etree"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedEnvelope encodes and signs an envelope the way a Client would
+func signedEnvelope(t *testing.T, signer *Signer, name xml.Name, env *Envelope) *etree.Document {
+	t.Helper()
+
+	payload, err := marshalEnvelope(xml.StartElement{Name: name}, env)
+	require.NoError(t, err)
+	payload, err = handleRequest([]EnvelopeHandler{signer}, Operation{}, payload)
+	require.NoError(t, err)
+
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromBytes(payload))
+	return doc
+}
+
+func TestVerifier(t *testing.T) {
+
+	key, cert := testCertificate(t, "server")
+	_, other := testCertificate(t, "other")
+	traceName := xml.Name{Space: "urn:example:trace", Local: "Trace"}
+	name := xml.Name{Space: "urn:example:quotes", Local: "GetQuoteResponse"}
+	env := &Envelope{
+		Headers: []Header{{Name: traceName, Value: &trace{ID: "1"}}},
+		Body:    &quoteResponse{Price: "42"},
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	verifier := &Verifier{Roots: roots, Headers: []xml.Name{traceName}, RequireTimestamp: true}
+
+	for _, keyInfo := range []KeyInfoType{KeyInfoSecurityToken, KeyInfoX509Data} {
+		doc := signedEnvelope(t, &Signer{Key: key, Certificate: cert, Headers: []xml.Name{traceName}, KeyInfo: keyInfo}, name, env)
+		verified, err := verifier.Verify(doc)
+		require.NoError(t, err)
+		require.True(t, verified.Equal(cert))
+	}
+
+	signer := &Signer{Key: key, Certificate: cert, Headers: []xml.Name{traceName}}
+	tests := map[string]func(doc *etree.Document){
+		"tampered body": func(doc *etree.Document) {
+			doc.FindElement("//price").SetText("0")
+		},
+		"wrapped body": func(doc *etree.Document) {
+			// the signed body moves into a header, and an unsigned one takes its place
+			body := doc.FindElement("//Body")
+			wrapper := doc.FindElement("//Header").CreateElement("Wrapper")
+			wrapper.AddChild(body.Copy())
+			body.RemoveAttr("wsu:Id")
+			body.FindElement("//price").SetText("0")
+		},
+		"duplicate id": func(doc *etree.Document) {
+			body := doc.FindElement("//Body")
+			doc.FindElement("//Header").AddChild(body.Copy())
+		},
+		"unsigned header": func(doc *etree.Document) {
+			doc.FindElement("//Header").AddChild(doc.FindElement("//Header/Trace").Copy())
+		},
+		"second header": func(doc *etree.Document) {
+			// the decoder would read the unsigned copy of the block after the signed one
+			header := doc.Root().CreateElement("soap:Header")
+			header.AddChild(doc.FindElement("//Header/Trace").Copy())
+			doc.Root().InsertChildAt(1, header)
+		},
+		"second body": func(doc *etree.Document) {
+			doc.Root().AddChild(doc.FindElement("//Body").Copy())
+		},
+		"second security": func(doc *etree.Document) {
+			doc.FindElement("//Header").AddChild(doc.FindElement("//Security").Copy())
+		},
+		"created in the future": func(doc *etree.Document) {
+			doc.FindElement("//Timestamp/Created").SetText(time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+		},
+		"unsigned": func(doc *etree.Document) {
+			security := doc.FindElement("//Security")
+			security.RemoveChild(security.SelectElement("Signature"))
+		},
+	}
+	for test, tamper := range tests {
+		doc := signedEnvelope(t, signer, name, env)
+		tamper(doc)
+		_, err := verifier.Verify(doc)
+		require.Error(t, err, test)
+	}
+
+	untrusted := x509.NewCertPool()
+	untrusted.AddCert(other)
+	_, err := (&Verifier{Roots: untrusted}).Verify(signedEnvelope(t, signer, name, env))
+	require.ErrorContains(t, err, "not trusted")
+
+	_, err = (&Verifier{}).Verify(signedEnvelope(t, signer, name, env))
+	require.ErrorContains(t, err, "no trusted roots")
+}
+
+func TestUnmarshalEnvelopeRepeated(t *testing.T) {
+
+	trace := &trace{}
+	env := &Envelope{Headers: []Header{{Name: xml.Name{Space: "urn:example:trace", Local: "Trace"}, Value: trace}}}
+	payload := `<soap:Envelope xmlns:soap="` + EnvelopeNamespace + `">` +
+		`<soap:Header><t:Trace xmlns:t="urn:example:trace"><Id>signed</Id></t:Trace></soap:Header>` +
+		`<soap:Header><t:Trace xmlns:t="urn:example:trace"><Id>copy</Id></t:Trace></soap:Header>` +
+		`<soap:Body/></soap:Envelope>`
+	err := unmarshalEnvelope(strings.NewReader(payload), env, nil)
+	require.ErrorContains(t, err, "more than one Header")
+
+	payload = `<soap:Envelope xmlns:soap="` + EnvelopeNamespace + `"><soap:Header>` +
+		`<wsse:Security xmlns:wsse="` + WSSENamespace + `"/><wsse:Security xmlns:wsse="` + WSSENamespace + `"/>` +
+		`</soap:Header><soap:Body/></soap:Envelope>`
+	err = unmarshalEnvelope(strings.NewReader(payload), env, nil)
+	require.ErrorContains(t, err, "more than one Security")
+}
+
+func TestVerifierClient(t *testing.T) {
+
+	key, cert := testCertificate(t, "server")
+	op := Operation{
+		Name:     "GetQuote",
+		Request:  xml.Name{Space: "urn:example:quotes", Local: "GetQuote"},
+		Response: xml.Name{Space: "urn:example:quotes", Local: "GetQuoteResponse"},
+	}
+
+	signed, fault := true, false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fault {
+			writeFault(w, &Fault{Code: "soap:Server", String: "forged"}, xml.Name{}, nil)
+			return
+		}
+		env := &Envelope{Body: &quoteResponse{Price: "42"}}
+		if !signed {
+			payload, err := marshalEnvelope(prefixedElement(op.Response), env)
+			require.NoError(t, err)
+			w.Write(payload)
+			return
+		}
+		signedEnvelope(t, &Signer{Key: key, Certificate: cert}, op.Response, env).WriteTo(w)
+	}))
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := NewClient(server.URL)
+	client.Verifier = &Verifier{Roots: roots}
+
+	response := &Envelope{Body: &quoteResponse{}}
+	require.NoError(t, client.Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, response))
+	require.Equal(t, "42", response.Body.(*quoteResponse).Price)
+	require.True(t, response.Certificate.Equal(cert))
+
+	signed = false
+	err := client.Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, &Envelope{Body: &quoteResponse{}})
+	require.ErrorContains(t, err, "not signed")
+
+	// unsigned faults are not decoded
+	fault = true
+	err = client.Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, &Envelope{Body: &quoteResponse{}})
+	require.ErrorContains(t, err, "unverified fault")
+	var decoded *Fault
+	require.False(t, errors.As(err, &decoded))
+}
+
+func TestVerifierHandler(t *testing.T) {
+
+	key, cert := testCertificate(t, "client")
+	op := Operation{
+		Name:     "GetQuote",
+		Action:   "urn:example:quotes:GetQuote",
+		Request:  xml.Name{Space: "urn:example:quotes", Local: "GetQuote"},
+		Response: xml.Name{Space: "urn:example:quotes", Local: "GetQuoteResponse"},
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	handler := NewHandler(Endpoint{
+		Operation: op,
+		Serve: func(ctx context.Context, decode func(*Envelope) error) (*Envelope, error) {
+			request := new(quoteRequest)
+			if err := decode(&Envelope{Body: request}); err != nil {
+				return nil, err
+			}
+			return &Envelope{Body: &quoteResponse{Price: VerifiedCertificate(ctx).Subject.CommonName}}, nil
+		},
+	})
+	handler.Verifier = &Verifier{Roots: roots}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	client.EnvelopeHandlers = []EnvelopeHandler{&Signer{Key: key, Certificate: cert}}
+	response := &quoteResponse{}
+	require.NoError(t, client.Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, &Envelope{Body: response}))
+	require.Equal(t, "client", response.Price)
+
+	err := NewClient(server.URL).Call(context.Background(), op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}}, &Envelope{Body: response})
+	var fault *Fault
+	require.ErrorAs(t, err, &fault)
+	require.Equal(t, "soap:Client", fault.Code)
+}
@@ -0,0 +1,100 @@
+package soap
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"github.com/beevik/etree"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Namespaces and token types of the OASIS Web Services Security standard
+const (
+	WSSENamespace = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"
+	WSUNamespace  = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"
+
+	PasswordText   = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordText"
+	PasswordDigest = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest"
+	Base64Binary   = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary"
+)
+
+// UsernameToken is an EnvelopeHandler adding a wsse:Security header with a UsernameToken to every request
+type UsernameToken struct {
+	Username string
+	Password string
+
+	// Digest sends the password as a PasswordDigest with a nonce and creation time, instead of as PasswordText
+	Digest bool
+
+	// Now returns the creation time of tokens, time.Now if nil
+	Now func() time.Time
+}
+
+func (t *UsernameToken) HandleRequest(op Operation, envelope *etree.Document) error {
+
+	security, err := SecurityHeader(envelope)
+	if err != nil {
+		return err
+	}
+
+	token := security.CreateElement("wsse:UsernameToken")
+	token.CreateElement("wsse:Username").SetText(t.Username)
+	password := token.CreateElement("wsse:Password")
+
+	if !t.Digest {
+		password.CreateAttr("Type", PasswordText)
+		password.SetText(t.Password)
+		return nil
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return errors.WithStack(err)
+	}
+
+	now := time.Now
+	if t.Now != nil {
+		now = t.Now
+	}
+	created := now().UTC().Format(time.RFC3339)
+
+	password.CreateAttr("Type", PasswordDigest)
+	password.SetText(PasswordDigestOf(nonce, created, t.Password))
+
+	nonceElm := token.CreateElement("wsse:Nonce")
+	nonceElm.CreateAttr("EncodingType", Base64Binary)
+	nonceElm.SetText(base64.StdEncoding.EncodeToString(nonce))
+
+	token.CreateElement("wsu:Created").SetText(created)
+
+	return nil
+}
+
+// PasswordDigestOf computes the password digest of a UsernameToken, Base64(SHA-1(nonce + created + password))
+func PasswordDigestOf(nonce []byte, created, password string) string {
+	h := sha1.New()
+	h.Write(nonce)
+	h.Write([]byte(created))
+	h.Write([]byte(password))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// SecurityHeader returns the wsse:Security header of an envelope, creating it if missing. The wsse and wsu
+// prefixes are declared on it, also when it came from a typed header.
+func SecurityHeader(envelope *etree.Document) (*etree.Element, error) {
+
+	header, err := EnvelopeHeader(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	security := findChild(header, WSSENamespace, "Security")
+	if security == nil {
+		security = header.CreateElement("wsse:Security")
+	}
+	security.CreateAttr("xmlns:wsse", WSSENamespace)
+	security.CreateAttr("xmlns:wsu", WSUNamespace)
+
+	return security, nil
+}
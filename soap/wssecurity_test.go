@@ -0,0 +1,70 @@
+package soap
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// captureRequest calls op on a server replying with an empty body, and returns the request envelope it received
+func captureRequest(t *testing.T, client *Client, op Operation, request *Envelope) *etree.Document {
+
+	doc := etree.NewDocument()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, doc.ReadFromBytes(body))
+		io.WriteString(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body/></soap:Envelope>`)
+	}))
+	defer server.Close()
+
+	client.URL = server.URL
+	require.NoError(t, client.Call(context.Background(), op, request, &Envelope{}))
+
+	return doc
+}
+
+func TestUsernameToken(t *testing.T) {
+
+	op := Operation{Name: "GetQuote", Request: xml.Name{Space: "urn:example:quotes", Local: "GetQuote"}}
+
+	client := NewClient("")
+	client.EnvelopeHandlers = append(client.EnvelopeHandlers, &UsernameToken{Username: "alice", Password: "secret"})
+	doc := captureRequest(t, client, op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}})
+
+	password := doc.FindElement("//Header/Security/UsernameToken/Password")
+	require.NotNil(t, password)
+	require.Equal(t, "secret", password.Text())
+	require.Equal(t, PasswordText, password.SelectAttrValue("Type", ""))
+	require.Equal(t, "alice", doc.FindElement("//UsernameToken/Username").Text())
+	require.Equal(t, WSSENamespace, password.NamespaceURI())
+	require.NotNil(t, doc.FindElement("//Body/GetQuote"))
+
+	created := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	client.EnvelopeHandlers = []EnvelopeHandler{&UsernameToken{Username: "alice", Password: "secret", Digest: true, Now: func() time.Time { return created }}}
+	doc = captureRequest(t, client, op, &Envelope{Body: &quoteRequest{Symbol: "ACME"}})
+
+	password = doc.FindElement("//UsernameToken/Password")
+	require.Equal(t, PasswordDigest, password.SelectAttrValue("Type", ""))
+	require.Equal(t, "2023-05-01T12:00:00Z", doc.FindElement("//UsernameToken/Created").Text())
+	require.Equal(t, WSUNamespace, doc.FindElement("//UsernameToken/Created").NamespaceURI())
+
+	nonce, err := base64.StdEncoding.DecodeString(doc.FindElement("//UsernameToken/Nonce").Text())
+	require.NoError(t, err)
+	require.Len(t, nonce, 16)
+	require.Equal(t, PasswordDigestOf(nonce, "2023-05-01T12:00:00Z", "secret"), password.Text())
+}
+
+func TestPasswordDigestOf(t *testing.T) {
+	// Base64(SHA-1(nonce + created + password)), computed independently
+	nonce, err := base64.StdEncoding.DecodeString("LKqI6G/AikKCQrN0zqZFlg==")
+	require.NoError(t, err)
+	require.Equal(t, "tuOSpGlFlIXsozq4HFNeeGeFLEI=", PasswordDigestOf(nonce, "2010-09-16T07:50:45Z", "userpassword"))
+}
@@ -0,0 +1,570 @@
+package gowhistler
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/beevik/etree"
+	"github.com/keanpedersen/gowhistler/soap"
+	"github.com/pkg/errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ValidationError is a violation of the schemas, at an XPath like location of the element
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors are all the violations found in a document
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// validator checks elements against the parsed schemas, collecting the violations
+type validator struct {
+	wsdl   *WSDL
+	errors ValidationErrors
+}
+
+func (v *validator) fail(path string, format string, args ...interface{}) {
+	v.errors = append(v.errors, &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) result() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return v.errors
+}
+
+// Validate checks an element against the global element declaration of its name: the order and occurrence
+// of its children, choices, attributes, the facets of restrictions and the lexical form of simple values. The
+// violations are returned as ValidationErrors. Types the parser does not model, eg. extensions of complex
+// types, accept any content.
+func (wsdl *WSDL) Validate(elm *etree.Element) error {
+
+	v := &validator{wsdl: wsdl}
+	v.global(elm, "/"+elm.Tag)
+	return v.result()
+}
+
+// ValidateDocument parses and validates an XML document. The header blocks and body of a SOAP envelope are
+// validated by themselves, header blocks without a declaration are skipped. Bodies of rpc style operations are
+// validated by the parts of their message.
+func (wsdl *WSDL) ValidateDocument(data []byte) error {
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return errors.WithStack(err)
+	}
+	root := doc.Root()
+	if root == nil {
+		return errors.New("No root element in document")
+	}
+
+	v := &validator{wsdl: wsdl}
+	if root.Tag != "Envelope" || root.NamespaceURI() != soap.EnvelopeNamespace {
+		v.global(root, "/"+root.Tag)
+		return v.result()
+	}
+
+	for _, part := range root.ChildElements() {
+		partPath := "/Envelope/" + part.Tag
+		for _, child := range part.ChildElements() {
+			path := partPath + "/" + child.Tag
+			if part.Tag == "Header" {
+				if _, err := wsdl.elementTypeRef(child.NamespaceURI() + ":" + child.Tag); err != nil {
+					continue
+				}
+			}
+			if part.Tag == "Body" && child.Tag == "Fault" && child.NamespaceURI() == soap.EnvelopeNamespace {
+				continue
+			}
+			if part.Tag == "Body" {
+				parts, ok, err := wsdl.rpcParts(child)
+				if err != nil {
+					v.fail(path, "%v", err)
+					continue
+				}
+				if ok {
+					v.rpcWrapper(child, path, parts)
+					continue
+				}
+			}
+			v.global(child, path)
+		}
+	}
+	return v.result()
+}
+
+// rpcParts returns the body parts of the rpc style message whose wrapper elm is, named by the operation for
+// requests and suffixed by Response for responses, in the namespace of soap:body
+func (wsdl *WSDL) rpcParts(elm *etree.Element) (parts []MessagePart, ok bool, err error) {
+
+	for _, binding := range wsdl.Bindings {
+		for _, op := range binding.Operations {
+			if op.Style != StyleRPC {
+				continue
+			}
+			for _, response := range []bool{false, true} {
+				components, wrapperName := op.Input, op.Name
+				if response {
+					components, wrapperName = op.Output, op.Name+"Response"
+				}
+				var soapBody BindingOperationComponent
+				for _, component := range components {
+					if component.In == "body" {
+						soapBody = component
+					}
+				}
+				if elm.Tag != wrapperName || elm.NamespaceURI() != soapBody.Namespace {
+					continue
+				}
+
+				portType, err := wsdl.FindPort(binding.Type)
+				if err != nil {
+					return nil, false, err
+				}
+				portOp, err := portType.FindOperation(op.Name)
+				if err != nil {
+					return nil, false, err
+				}
+				messageName := portOp.Input.Message
+				if response {
+					messageName = portOp.Output.Message
+				}
+				message, err := wsdl.FindMessage(messageName)
+				if err != nil {
+					return nil, false, err
+				}
+				parts = bodyParts(message, soapBody)
+				if len(soapBody.Parts) == 0 {
+					parts = withoutAttachments(parts, components)
+				}
+				return parts, true, nil
+			}
+		}
+	}
+	return nil, false, nil
+}
+
+// rpcWrapper validates the wrapper of an rpc style message, holding the parts in order: unqualified elements
+// named by the parts of a type, and the global elements of the parts of an element
+func (v *validator) rpcWrapper(elm *etree.Element, path string, parts []MessagePart) {
+
+	children := elm.ChildElements()
+	for i, part := range parts {
+		ns, name, typeRef := "", part.Name, part.Type
+		if part.Element != "" {
+			ns, name = splitFullName(part.Element)
+			typeRef = ""
+		}
+		if i >= len(children) || children[i].Tag != name || children[i].NamespaceURI() != ns {
+			v.fail(path, "expected part %s", part.Name)
+			return
+		}
+		if typeRef == "" {
+			v.global(children[i], childPath(path, elm, children[i]))
+			continue
+		}
+		v.element(children[i], childPath(path, elm, children[i]), typeRef)
+	}
+
+	for i := len(parts); i < len(children); i++ {
+		v.fail(childPath(path, elm, children[i]), "unexpected element")
+	}
+}
+
+// global validates an element against the declaration of its name
+func (v *validator) global(elm *etree.Element, path string) {
+
+	typeRef, err := v.wsdl.elementTypeRef(elm.NamespaceURI() + ":" + elm.Tag)
+	if err != nil {
+		v.fail(path, "no declaration of element {%s}%s", elm.NamespaceURI(), elm.Tag)
+		return
+	}
+	v.element(elm, path, typeRef)
+}
+
+// element validates the attributes and content of an element of the referenced type
+func (v *validator) element(elm *etree.Element, path, typeRef string) {
+
+	tp, ok := v.wsdl.TypeMap[strings.ToLower(typeRef)]
+	if !ok {
+		v.fail(path, "unknown type %v", typeRef)
+		return
+	}
+
+	structured := len(tp.SubElements) > 0 || len(tp.ChoiceElements) > 0 || len(tp.AttributeElements) > 0
+	if !structured && tp.BuildIn == "" && tp.Type == "" && tp.ListItem == "" && len(tp.UnionMembers) == 0 && len(tp.Enum) == 0 {
+		// not modelled by the parser
+		return
+	}
+
+	v.attributes(elm, path, tp)
+
+	if !structured || (len(tp.SubElements) == 0 && len(tp.ChoiceElements) == 0 && tp.Type != "") {
+		if len(elm.ChildElements()) > 0 {
+			v.fail(path, "unexpected element %s in simple content", elm.ChildElements()[0].Tag)
+			return
+		}
+		if message := v.simpleValue(elm.Text(), typeRef); message != "" {
+			v.fail(path, "%s", message)
+		}
+		return
+	}
+
+	if strings.TrimSpace(elm.Text()) != "" {
+		v.fail(path, "unexpected text in element only content")
+	}
+	v.children(elm, path, tp)
+}
+
+func (v *validator) attributes(elm *etree.Element, path string, tp ElementType) {
+
+	for _, attr := range elm.Attr {
+		// namespace declarations, xsi attributes and attributes of other vocabularies, eg. wsu:Id
+		if attr.Space != "" || attr.Key == "xmlns" {
+			continue
+		}
+		attrType, ok := tp.AttributeElements[attr.Key]
+		if !ok {
+			v.fail(path+"/@"+attr.Key, "unexpected attribute")
+			continue
+		}
+		if message := v.simpleValue(attr.Value, attrType); message != "" {
+			v.fail(path+"/@"+attr.Key, "%s", message)
+		}
+	}
+
+	for _, name := range tp.RequiredAttributes {
+		if elm.SelectAttr(name) == nil {
+			v.fail(path, "missing required attribute %s", name)
+		}
+	}
+}
+
+// children validates the sequence, then the choice, of the child elements of a complex type
+func (v *validator) children(elm *etree.Element, path string, tp ElementType) {
+
+	children := elm.ChildElements()
+	i := 0
+
+	for _, sub := range tp.SubElements {
+		ns, name, typeRef, err := v.wsdl.subElementName(sub)
+		if err != nil {
+			v.fail(path, "%v", err)
+			return
+		}
+
+		count := 0
+		for ; i < len(children) && children[i].Tag == name && children[i].NamespaceURI() == ns; i++ {
+			count++
+			v.element(children[i], childPath(path, elm, children[i]), typeRef)
+		}
+		if count < sub.MinOccurs {
+			v.fail(path, "expected %v %s element(s), found %v", sub.MinOccurs, name, count)
+		}
+		if sub.MaxOccurs > 0 && count > sub.MaxOccurs {
+			v.fail(path, "expected at most %v %s element(s), found %v", sub.MaxOccurs, name, count)
+		}
+	}
+
+	if len(tp.ChoiceElements) > 0 {
+		chosen := ""
+		var names []string
+		for _, sub := range tp.ChoiceElements {
+			ns, name, typeRef, err := v.wsdl.subElementName(sub)
+			if err != nil {
+				v.fail(path, "%v", err)
+				return
+			}
+			names = append(names, name)
+
+			count := 0
+			for ; i < len(children) && children[i].Tag == name && children[i].NamespaceURI() == ns; i++ {
+				count++
+				v.element(children[i], childPath(path, elm, children[i]), typeRef)
+			}
+			if count == 0 {
+				continue
+			}
+			if chosen != "" {
+				v.fail(path, "both %s and %s of a choice", chosen, name)
+			}
+			chosen = name
+			if sub.MaxOccurs > 0 && count > sub.MaxOccurs {
+				v.fail(path, "expected at most %v %s element(s), found %v", sub.MaxOccurs, name, count)
+			}
+		}
+		if chosen == "" {
+			v.fail(path, "expected one of %s", strings.Join(names, ", "))
+		}
+	}
+
+	for ; i < len(children); i++ {
+		v.fail(childPath(path, elm, children[i]), "unexpected element")
+	}
+}
+
+// childPath is the path of a child element, with its position when it has siblings of the same name
+func childPath(path string, parent, child *etree.Element) string {
+
+	position, count := 0, 0
+	for _, sibling := range parent.ChildElements() {
+		if sibling.Tag == child.Tag && sibling.NamespaceURI() == child.NamespaceURI() {
+			count++
+			if sibling == child {
+				position = count
+			}
+		}
+	}
+	if count > 1 {
+		return fmt.Sprintf("%s/%s[%d]", path, child.Tag, position)
+	}
+	return path + "/" + child.Tag
+}
+
+// simpleValue checks a value against the referenced simple type, returning what is wrong or ""
+func (v *validator) simpleValue(value, typeRef string) string {
+
+	tp, ok := v.wsdl.TypeMap[strings.ToLower(typeRef)]
+	if !ok {
+		return fmt.Sprintf("unknown type %v", typeRef)
+	}
+	builtIn, whiteSpace := v.wsdl.restrictionBase(typeRef)
+	value = normalizeSpace(value, whiteSpace)
+
+	if tp.ListItem != "" {
+		for _, item := range strings.Fields(value) {
+			if message := v.simpleValue(item, tp.ListItem); message != "" {
+				return message
+			}
+		}
+		return ""
+	}
+	if len(tp.UnionMembers) > 0 {
+		for _, member := range tp.UnionMembers {
+			if v.simpleValue(value, member) == "" {
+				return ""
+			}
+		}
+		return fmt.Sprintf("value %q is not valid for any member of the union", value)
+	}
+
+	if len(tp.Enum) > 0 {
+		found := false
+		for _, enum := range tp.Enum {
+			found = found || enum == value
+		}
+		if !found {
+			return fmt.Sprintf("value %q is not one of %s", value, strings.Join(tp.Enum, ", "))
+		}
+	}
+	if len(tp.Patterns) > 0 {
+		// schema only syntax, eg. \i or \p{IsBasicLatin}, does not compile as a go regular expression
+		re, err := regexp.Compile(tp.patternExpr())
+		if err != nil {
+			return fmt.Sprintf("value %q can not be checked against unsupported pattern %s", value, strings.Join(tp.Patterns, "|"))
+		}
+		if !re.MatchString(value) {
+			return fmt.Sprintf("value %q does not match pattern %s", value, strings.Join(tp.Patterns, "|"))
+		}
+	}
+	if message := facets(value, tp, builtIn); message != "" {
+		return message
+	}
+
+	if tp.BuildIn != "" {
+		return lexicalForm(value, typeRef)
+	}
+	if tp.Type != "" {
+		return v.simpleValue(value, tp.Type)
+	}
+	return ""
+}
+
+// restrictionBase returns the lower case name of the built in type a simple type restricts, or "list" and "union"
+// for restrictions of those, and the whiteSpace facet in effect for it
+func (wsdl *WSDL) restrictionBase(typeRef string) (builtIn string, whiteSpace string) {
+
+	seen := make(map[string]bool)
+	for !seen[strings.ToLower(typeRef)] {
+		seen[strings.ToLower(typeRef)] = true
+		tp, ok := wsdl.TypeMap[strings.ToLower(typeRef)]
+		if !ok {
+			break
+		}
+		if whiteSpace == "" {
+			whiteSpace = tp.WhiteSpace
+		}
+		if tp.ListItem != "" || len(tp.UnionMembers) > 0 {
+			builtIn = "union"
+			if tp.ListItem != "" {
+				builtIn = "list"
+			}
+			break
+		}
+		if tp.BuildIn != "" {
+			_, name := splitFullName(typeRef)
+			builtIn = strings.ToLower(name)
+			break
+		}
+		typeRef = tp.Type
+	}
+
+	if whiteSpace == "" && builtIn != "string" {
+		// only strings preserve white space by default
+		whiteSpace = "collapse"
+	}
+	return builtIn, whiteSpace
+}
+
+// normalizeSpace applies a whiteSpace facet to a value
+func normalizeSpace(value, whiteSpace string) string {
+	switch whiteSpace {
+	case "replace":
+		return strings.Map(func(r rune) rune {
+			if r == '\t' || r == '\n' || r == '\r' {
+				return ' '
+			}
+			return r
+		}, value)
+	case "collapse":
+		return strings.Join(strings.Fields(value), " ")
+	}
+	return value
+}
+
+// facets checks a value against the length, bound and digits facets of a simple type. Lengths of binary types
+// are in octets and of lists in items, bounds are only checked for numbers.
+func facets(value string, tp ElementType, builtIn string) string {
+
+	length := utf8.RuneCountInString(value)
+	if builtIn == "list" {
+		length = len(strings.Fields(value))
+	}
+	if builtIn == "base64binary" {
+		if decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), "")); err == nil {
+			length = len(decoded)
+		}
+	}
+	if limit, err := strconv.Atoi(tp.Length); err == nil && length != limit {
+		return fmt.Sprintf("length %v is not %v", length, limit)
+	}
+	if limit, err := strconv.Atoi(tp.MinLength); err == nil && length < limit {
+		return fmt.Sprintf("length %v is below the minimum length %v", length, limit)
+	}
+	if limit, err := strconv.Atoi(tp.MaxLength); err == nil && length > limit {
+		return fmt.Sprintf("length %v is above the maximum length %v", length, limit)
+	}
+
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		bounds := []struct {
+			limit   string
+			fails   func(number, limit float64) bool
+			message string
+		}{
+			{tp.MinInclusive, func(number, limit float64) bool { return number < limit }, "is below the minimum"},
+			{tp.MaxInclusive, func(number, limit float64) bool { return number > limit }, "is above the maximum"},
+			{tp.MinExclusive, func(number, limit float64) bool { return number <= limit }, "is not above"},
+			{tp.MaxExclusive, func(number, limit float64) bool { return number >= limit }, "is not below"},
+		}
+		for _, bound := range bounds {
+			if limit, err := strconv.ParseFloat(bound.limit, 64); err == nil && bound.fails(number, limit) {
+				return fmt.Sprintf("value %q %s %s", value, bound.message, bound.limit)
+			}
+		}
+	}
+
+	if total, fraction, ok := soap.DecimalDigits(value); ok {
+		if limit, err := strconv.Atoi(tp.TotalDigits); err == nil && total > limit {
+			return fmt.Sprintf("value %q has %v digits, more than %v", value, total, limit)
+		}
+		if limit, err := strconv.Atoi(tp.FractionDigits); err == nil && fraction > limit {
+			return fmt.Sprintf("value %q has %v fraction digits, more than %v", value, fraction, limit)
+		}
+	}
+	return ""
+}
+
+var (
+	integerForm = regexp.MustCompile(`^[+-]?[0-9]+$`)
+	decimalForm = regexp.MustCompile(`^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)$`)
+	dateForm    = regexp.MustCompile(`^(-?[0-9]{4,})-([0-9]{2})-([0-9]{2})(Z|[+-][0-9]{2}:[0-9]{2})?$`)
+)
+
+// lexicalForm checks a value against the lexical space of a built in schema type
+func lexicalForm(value, typeRef string) string {
+
+	_, name := splitFullName(typeRef)
+	collapsed := strings.TrimSpace(value)
+
+	ok := true
+	switch strings.ToLower(name) {
+	case "boolean":
+		ok = collapsed == "true" || collapsed == "false" || collapsed == "1" || collapsed == "0"
+	case "int":
+		_, err := strconv.ParseInt(collapsed, 10, 32)
+		ok = err == nil
+	case "long":
+		_, err := strconv.ParseInt(collapsed, 10, 64)
+		ok = err == nil
+	case "integer":
+		ok = integerForm.MatchString(collapsed)
+	case "decimal":
+		ok = decimalForm.MatchString(collapsed)
+	case "float", "double":
+		_, err := strconv.ParseFloat(collapsed, 64)
+		ok = err == nil || collapsed == "INF" || collapsed == "-INF" || collapsed == "NaN"
+	case "date":
+		ok = validDate(collapsed)
+	case "datetime":
+		_, err := time.Parse(time.RFC3339Nano, collapsed)
+		if err != nil {
+			_, err = time.Parse("2006-01-02T15:04:05.999999999", collapsed)
+		}
+		ok = err == nil
+	case "base64binary":
+		_, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+		ok = err == nil
+	}
+
+	if !ok {
+		return fmt.Sprintf("value %q is not a valid %s", value, name)
+	}
+	return ""
+}
+
+// validDate checks the form of an xs:date and that its day exists. The year may have more than four digits,
+// so it is parsed apart from the month and day.
+func validDate(value string) bool {
+
+	match := dateForm.FindStringSubmatch(value)
+	if match == nil {
+		return false
+	}
+	year, err := strconv.Atoi(match[1])
+	if err != nil {
+		return false
+	}
+	month, _ := strconv.Atoi(match[2])
+	day, _ := strconv.Atoi(match[3])
+
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	return date.Year() == year && int(date.Month()) == month && date.Day() == day
+}
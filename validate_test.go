@@ -0,0 +1,298 @@
+package gowhistler
+
+import (
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestValidateSamples(t *testing.T) {
+	urls := []string{"testdata/orders.wsdl", "testdata/wrapped.wsdl", "testdata/attachments.wsdl", "testdata/rpc.wsdl", "testdata/addressing.wsdl"}
+	for _, url := range urls {
+		wsdl, err := Parse(url)
+		require.NoError(t, err)
+
+		for _, binding := range wsdl.Bindings {
+			for _, op := range binding.Operations {
+				for _, response := range []bool{false, true} {
+					doc, err := wsdl.SampleEnvelope(binding, op, response)
+					require.NoError(t, err)
+					data, err := doc.WriteToBytes()
+					require.NoError(t, err)
+					require.NoError(t, wsdl.ValidateDocument(data), string(data))
+				}
+			}
+		}
+
+		for _, elm := range wsdl.Elements {
+			ns := elm.NameSpace
+			if ns == "" {
+				ns = wsdl.TargetNamespace
+			}
+			sample, err := wsdl.SampleElement(ns + ":" + elm.Name)
+			require.NoError(t, err)
+			doc := etree.NewDocument()
+			doc.SetRoot(sample)
+			data, err := doc.WriteToBytes()
+			require.NoError(t, err)
+			require.NoError(t, wsdl.ValidateDocument(data), string(data))
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	wsdl, err := Parse("testdata/orders.wsdl")
+	require.NoError(t, err)
+
+	err = wsdl.ValidateDocument([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+		<soap:Header><Unknown xmlns="urn:example:other"/></soap:Header>
+		<soap:Body>
+			<PlaceOrder xmlns="urn:example:orders">
+				<Customer><Email>a@example.com</Email><Phone>1234</Phone></Customer>
+				<Order>
+					<Id>12x</Id>
+					<Status>lost</Status>
+					<Placed>2024-02-30T10:00:00Z</Placed>
+					<Line unit="kg" colour="red"><Sku>ABC-1234</Sku><Quantity>1</Quantity></Line>
+					<Line><Sku>abc</Sku><Quantity>2</Quantity></Line>
+					<Extra/>
+				</Order>
+			</PlaceOrder>
+		</soap:Body>
+	</soap:Envelope>`))
+
+	var errs ValidationErrors
+	require.ErrorAs(t, err, &errs)
+
+	messages := make(map[string]string)
+	for _, e := range errs {
+		messages[e.Path] += e.Message
+	}
+	require.Equal(t, map[string]string{
+		"/Envelope/Body/PlaceOrder/Customer":              "both Email and Phone of a choice",
+		"/Envelope/Body/PlaceOrder/Order/Id":              `value "12x" is not a valid int`,
+		"/Envelope/Body/PlaceOrder/Order/Status":          `value "lost" is not one of open, shipped`,
+		"/Envelope/Body/PlaceOrder/Order/Placed":          `value "2024-02-30T10:00:00Z" is not a valid dateTime`,
+		"/Envelope/Body/PlaceOrder/Order/Line[1]/@colour": "unexpected attribute",
+		"/Envelope/Body/PlaceOrder/Order/Line[2]/Sku":     `value "abc" does not match pattern [A-Z]{3}-[0-9]{4}`,
+		"/Envelope/Body/PlaceOrder/Order":                 "expected 1 Note element(s), found 0",
+		"/Envelope/Body/PlaceOrder/Order/Extra":           "unexpected element",
+	}, messages)
+
+	err = wsdl.ValidateDocument([]byte(`<Other xmlns="urn:example:orders"/>`))
+	require.EqualError(t, err, "/Other: no declaration of element {urn:example:orders}Other")
+
+	err = wsdl.ValidateDocument([]byte(`<PlaceOrderResponse xmlns="urn:example:orders"><Accepted>yes</Accepted></PlaceOrderResponse>`))
+	require.EqualError(t, err, `/PlaceOrderResponse/Accepted: value "yes" is not a valid boolean`)
+}
+
+func TestValidateRPC(t *testing.T) {
+	wsdl, err := Parse("testdata/rpc.wsdl")
+	require.NoError(t, err)
+
+	envelope := func(body string) []byte {
+		return []byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` + body + `</soap:Body></soap:Envelope>`)
+	}
+	require.NoError(t, wsdl.ValidateDocument(envelope(`<q:GetQuote xmlns:q="urn:example:quotes"><symbol>ACME</symbol><count>2</count></q:GetQuote>`)))
+	require.NoError(t, wsdl.ValidateDocument(envelope(`<q:GetQuoteResponse xmlns:q="urn:example:quotes">`+
+		`<quote><Symbol>ACME</Symbol><Price>1.5</Price></quote></q:GetQuoteResponse>`)))
+
+	err = wsdl.ValidateDocument(envelope(`<q:GetQuote xmlns:q="urn:example:quotes"><symbol>ACME</symbol><count>two</count><extra/></q:GetQuote>`))
+	var errs ValidationErrors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 2)
+	require.Equal(t, "/Envelope/Body/GetQuote/count", errs[0].Path)
+	require.Equal(t, "/Envelope/Body/GetQuote/extra", errs[1].Path)
+
+	// the parts are unqualified
+	err = wsdl.ValidateDocument(envelope(`<GetQuote xmlns="urn:example:quotes"><symbol>ACME</symbol><count>2</count></GetQuote>`))
+	require.ErrorContains(t, err, "expected part symbol")
+}
+
+func TestValidateFacets(t *testing.T) {
+	wsdl, err := Parse("testdata/orders.wsdl")
+	require.NoError(t, err)
+
+	price := wsdl.TypeMap["urn:example:orders:pricetype"]
+	require.Equal(t, "0", price.MinExclusive)
+	require.Equal(t, "7", price.TotalDigits)
+	require.Equal(t, "2", price.FractionDigits)
+	code := wsdl.TypeMap["urn:example:orders:codetype"]
+	require.Equal(t, []string{"[a-z]+", "[0-9]+"}, code.Patterns)
+	require.Equal(t, "collapse", code.WhiteSpace)
+
+	for document, expected := range map[string]string{
+		`<Price xmlns="urn:example:orders">12.50</Price>`:     "",
+		`<Price xmlns="urn:example:orders">0</Price>`:         `/Price: value "0" is not above 0`,
+		`<Price xmlns="urn:example:orders">1234567.8</Price>`: `/Price: value "1234567.8" has 8 digits, more than 7`,
+		`<Price xmlns="urn:example:orders">1.005</Price>`:     `/Price: value "1.005" has 3 fraction digits, more than 2`,
+		`<Code xmlns="urn:example:orders"> abc </Code>`:       "",
+		`<Code xmlns="urn:example:orders">12</Code>`:          "",
+		`<Code xmlns="urn:example:orders">a1</Code>`:          `/Code: value "a1" does not match pattern [a-z]+|[0-9]+`,
+		`<Code xmlns="urn:example:orders">abcdef</Code>`:      "/Code: length 6 is above the maximum length 5",
+	} {
+		err := wsdl.ValidateDocument([]byte(document))
+		if expected == "" {
+			require.NoError(t, err, document)
+		} else {
+			require.EqualError(t, err, expected, document)
+		}
+	}
+}
+
+func TestValidateUnsupportedPattern(t *testing.T) {
+	wsdl, err := Parse("testdata/orders.wsdl")
+	require.NoError(t, err)
+
+	// \i and \c are the name characters of XML schema regular expressions
+	wsdl.TypeMap["urn:example:orders:tokentype"] = ElementType{
+		NameSpace: "urn:example:orders",
+		Name:      "TokenType",
+		Type:      "http://www.w3.org/2001/XMLSchema:string",
+		Patterns:  []string{`\i\c*`},
+	}
+	v := &validator{wsdl: wsdl}
+	require.Equal(t, `value "abc" can not be checked against unsupported pattern \i\c*`, v.simpleValue("abc", "urn:example:orders:TokenType"))
+}
+
+func TestValidateDates(t *testing.T) {
+	for value, valid := range map[string]bool{
+		"2024-02-29":       true,
+		"2023-02-29":       false,
+		"2024-13-01":       false,
+		"12024-05-01":      true,
+		"-0044-03-15":      true,
+		"2024-05-01+02:00": true,
+		"24-05-01":         false,
+	} {
+		require.Equal(t, valid, lexicalForm(value, "http://www.w3.org/2001/XMLSchema:date") == "", value)
+	}
+}
+
+func TestValidateListsAndUnions(t *testing.T) {
+	wsdl, err := Parse("testdata/orders.wsdl")
+	require.NoError(t, err)
+
+	require.Equal(t, "urn:example:orders:CodeType", wsdl.TypeMap["urn:example:orders:tagstype"].ListItem)
+	members := wsdl.TypeMap["urn:example:orders:referencetype"].UnionMembers
+	require.Len(t, members, 2)
+	require.Equal(t, "http://www.w3.org/2001/XMLSchema:int", members[0])
+
+	for document, expected := range map[string]string{
+		`<Tags xmlns="urn:example:orders"> ab  12 </Tags>`:        "",
+		`<Tags xmlns="urn:example:orders">ab x1</Tags>`:           `/Tags: value "x1" does not match pattern [a-z]+|[0-9]+`,
+		`<Reference xmlns="urn:example:orders">42</Reference>`:    "",
+		`<Reference xmlns="urn:example:orders">AB-12</Reference>`: "",
+		`<Reference xmlns="urn:example:orders">ab</Reference>`:    `/Reference: value "ab" is not valid for any member of the union`,
+	} {
+		err := wsdl.ValidateDocument([]byte(document))
+		if expected == "" {
+			require.NoError(t, err, document)
+		} else {
+			require.EqualError(t, err, expected, document)
+		}
+	}
+
+	for _, name := range []string{"urn:example:orders:Tags", "urn:example:orders:Reference"} {
+		elm, err := wsdl.SampleElement(name)
+		require.NoError(t, err)
+		require.NoError(t, wsdl.Validate(elm), name)
+	}
+}
+
+func TestValidateGroups(t *testing.T) {
+	wsdl, err := Parse("testdata/orders.wsdl")
+	require.NoError(t, err)
+
+	require.Contains(t, wsdl.Groups, "urn:example:orders:citygroup")
+	require.Contains(t, wsdl.AttributeGroups, "urn:example:orders:auditattributes")
+
+	address := wsdl.TypeMap["urn:example:orders:addresstype"]
+	var names []string
+	for _, sub := range address.SubElements {
+		names = append(names, sub.Name)
+	}
+	require.Equal(t, []string{"Street", "Zip", "City", "Country"}, names)
+	require.Len(t, address.ChoiceElements, 2)
+	require.Equal(t, map[string]string{
+		"createdBy": "http://www.w3.org/2001/XMLSchema:string",
+		"version":   "http://www.w3.org/2001/XMLSchema:int",
+	}, address.AttributeElements)
+	require.Equal(t, []string{"createdBy"}, address.RequiredAttributes)
+
+	elm, err := wsdl.SampleElement("urn:example:orders:Address")
+	require.NoError(t, err)
+	require.NoError(t, wsdl.Validate(elm))
+
+	err = wsdl.ValidateDocument([]byte(`<Address xmlns="urn:example:orders" version="x">` +
+		`<Street>Main</Street><City>Town</City><Email>a@example.com</Email></Address>`))
+	var errs ValidationErrors
+	require.ErrorAs(t, err, &errs)
+	messages := make(map[string]string)
+	for _, e := range errs {
+		messages[e.Path] += e.Message + ";"
+	}
+	require.Equal(t, map[string]string{
+		"/Address":          "missing required attribute createdBy;expected 1 Zip element(s), found 0;",
+		"/Address/@version": `value "x" is not a valid int;`,
+	}, messages)
+
+	remarks := wsdl.TypeMap["urn:example:orders:remarkstype"]
+	require.Len(t, remarks.SubElements, 1)
+	require.Equal(t, "Remark", remarks.SubElements[0].Name)
+	require.Equal(t, 1, remarks.SubElements[0].MinOccurs)
+	require.Equal(t, 0, remarks.SubElements[0].MaxOccurs)
+	require.NoError(t, wsdl.ValidateDocument([]byte(`<Remarks xmlns="urn:example:orders">`+
+		`<Remark>a</Remark><Remark>b</Remark><Remark>c</Remark></Remarks>`)))
+	require.Error(t, wsdl.ValidateDocument([]byte(`<Remarks xmlns="urn:example:orders"/>`)))
+
+	author := wsdl.TypeMap["urn:example:orders:authortype"]
+	require.Len(t, author.ChoiceElements, 2)
+	require.Equal(t, "SignedBy", author.ChoiceElements[1].Name)
+	require.NoError(t, wsdl.ValidateDocument([]byte(`<Author xmlns="urn:example:orders"><SignedBy>me</SignedBy></Author>`)))
+	require.Error(t, wsdl.ValidateDocument([]byte(`<Author xmlns="urn:example:orders">`+
+		`<Anonymous>true</Anonymous><SignedBy>me</SignedBy></Author>`)))
+}
+
+func TestExpandGroupsUnsupported(t *testing.T) {
+	wsdl, err := Parse("testdata/orders.wsdl")
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		tp      ElementType
+		message string
+	}{
+		"sequence in choice": {
+			tp:      ElementType{ChoiceElements: []Element{{Group: "urn:example:orders:CityGroup", MinOccurs: 1, MaxOccurs: 1}}},
+			message: "Sequence group urn:example:orders:CityGroup in a choice",
+		},
+		"repeated choice in choice": {
+			tp:      ElementType{ChoiceElements: []Element{{Group: "urn:example:orders:ContactGroup", MinOccurs: 1, MaxOccurs: 0}}},
+			message: "must occur once",
+		},
+		"unbounded sequence": {
+			tp:      ElementType{SubElements: []Element{{Group: "urn:example:orders:CityGroup", MinOccurs: 1, MaxOccurs: 0}}},
+			message: "Repeated group urn:example:orders:CityGroup",
+		},
+		"optional choice": {
+			tp:      ElementType{SubElements: []Element{{Group: "urn:example:orders:ContactGroup", MinOccurs: 0, MaxOccurs: 1}}},
+			message: "Optional choice group",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := wsdl.expandGroups(test.tp, 0)
+			require.ErrorContains(t, err, test.message)
+		})
+	}
+}
+
+func TestChoiceGroupsInSequence(t *testing.T) {
+
+	// the choice of a type is written after its sequence, and there is only one
+	_, err := Parse("testdata/choicegroup-order.wsdl")
+	require.ErrorContains(t, err, "Elements following choice group urn:example:groups:ContactGroup")
+
+	_, err = Parse("testdata/choicegroup-twice.wsdl")
+	require.ErrorContains(t, err, "Choice group urn:example:groups:PaymentGroup next to another choice")
+}
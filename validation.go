@@ -0,0 +1,306 @@
+package gowhistler
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// isStruct tells whether a type is generated as a struct, ie. it has elements or attributes
+func isStruct(tp ElementType) bool {
+	return len(tp.SubElements) > 0 || len(tp.ChoiceElements) > 0 || len(tp.AttributeElements) > 0
+}
+
+// baseKind returns the go type of the built in type a simple type restricts, "list" or "union" for restrictions
+// of those, and "" for structs
+func (wsdl *WSDL) baseKind(tp ElementType) string {
+
+	seen := make(map[string]bool)
+	for {
+		switch {
+		case tp.ListItem != "":
+			return "list"
+		case len(tp.UnionMembers) > 0:
+			return "union"
+		case tp.BuildIn != "" || isStruct(tp) || tp.Type == "" || seen[strings.ToLower(tp.Type)]:
+			return tp.BuildIn
+		}
+		seen[strings.ToLower(tp.Type)] = true
+		next, ok := wsdl.TypeMap[strings.ToLower(tp.Type)]
+		if !ok {
+			return ""
+		}
+		tp = next
+	}
+}
+
+// buildValidate builds the Validate method of a generated schema type. Simple types check the facets of their
+// restriction, structs check their required fields and choices and validate their children.
+func (wsdl *WSDL) buildValidate(builder *Builder, tp ElementType) error {
+
+	checks := ""
+	if isStruct(tp) {
+		for _, sub := range tp.SubElements {
+			name, subTp, _, err := wsdl.elementField(sub)
+			if err != nil {
+				return err
+			}
+			checks += wsdl.fieldChecks(builder, name, subTp, sub.MinOccurs > 0)
+		}
+
+		if len(tp.ChoiceElements) > 0 {
+			var names []string
+			checks += "choices := 0\n"
+			for _, sub := range tp.ChoiceElements {
+				name, subTp, _, err := wsdl.elementField(sub)
+				if err != nil {
+					return err
+				}
+				names = append(names, name)
+				checks += fmt.Sprintf("if v.%s != nil {\nchoices++\n%s}\n", name, wsdl.validateCall(builder, name, subTp))
+			}
+			builder.Imports["errors"] = true
+			checks += fmt.Sprintf("if choices != 1 {\nreturn errors.New(%q)\n}\n", "exactly one of "+strings.Join(names, ", ")+" is required")
+		}
+
+		for _, name := range sortedKeys(tp.AttributeElements) {
+			subTp, ok := wsdl.TypeMap[strings.ToLower(tp.AttributeElements[name])]
+			if !ok {
+				return errors.Errorf("Could not find attribute reference of type %v", tp.AttributeElements[name])
+			}
+			required := false
+			for _, requiredName := range tp.RequiredAttributes {
+				required = required || requiredName == name
+			}
+			checks += wsdl.fieldChecks(builder, ucFirst(name), subTp, required)
+		}
+	} else if tp.ListItem != "" {
+		itemTp, ok := wsdl.TypeMap[strings.ToLower(tp.ListItem)]
+		if !ok {
+			return errors.Errorf("Could not find item type %v", tp.ListItem)
+		}
+		if itemTp.BuildIn == "" {
+			builder.Imports["fmt"] = true
+			checks += "for i, item := range v {\nif err := item.Validate(); err != nil {\nreturn fmt.Errorf(\"item %v: %w\", i+1, err)\n}\n}\n"
+		}
+	} else if len(tp.UnionMembers) > 0 {
+		checks += "members := 0\n"
+		for i, member := range tp.UnionMembers {
+			memberTp, ok := wsdl.TypeMap[strings.ToLower(member)]
+			if !ok {
+				return errors.Errorf("Could not find member type %v", member)
+			}
+			validate := ""
+			if memberTp.BuildIn == "" {
+				validate = fmt.Sprintf("if err := v.%s.Validate(); err != nil {\nreturn err\n}\n", wsdl.unionField(tp, i))
+			}
+			checks += fmt.Sprintf("if v.%s != nil {\nmembers++\n%s}\n", wsdl.unionField(tp, i), validate)
+		}
+		builder.Imports["errors"] = true
+		checks += "if members != 1 {\nreturn errors.New(\"exactly one member of the union is required\")\n}\n"
+	} else if tp.Type != "" {
+		var err error
+		if checks, err = wsdl.facetChecks(builder, tp); err != nil {
+			return err
+		}
+	}
+
+	builder.Decls[tp.TypeName()+".Validate"] = fmt.Sprintf(`// Validate checks the value against the restrictions of the schema
+func (v %s) Validate() error {
+%sreturn nil
+}`, tp.TypeName(), checks)
+
+	return nil
+}
+
+// fieldChecks checks a field of a struct: required fields must not be empty, and generated types are validated
+// unless they are empty and optional. Numbers and booleans can not be told from absent values.
+func (wsdl *WSDL) fieldChecks(builder *Builder, field string, tp ElementType, required bool) string {
+
+	value := "v." + field
+	kind := wsdl.baseKind(tp)
+
+	empty, present := "", ""
+	switch kind {
+	case "string":
+		empty, present = value+` == ""`, value+` != ""`
+	case "time.Time":
+		empty, present = value+".IsZero()", "!"+value+".IsZero()"
+	case "soap.Binary":
+		empty, present = "len("+value+") == 0", "len("+value+") > 0"
+	case "int":
+		present = value + " != 0"
+	case "list":
+		present = "len(" + value + ") > 0"
+	case "", "union":
+		present = "!reflect.ValueOf(" + value + ").IsZero()"
+	}
+
+	checks := ""
+	if required && empty != "" {
+		builder.Imports["errors"] = true
+		checks += fmt.Sprintf("if %s {\nreturn errors.New(%q)\n}\n", empty, field+" is required")
+	}
+	if tp.BuildIn != "" {
+		// built in types carry no restrictions
+		return checks
+	}
+
+	call := wsdl.validateCall(builder, field, tp)
+	if !required && present != "" {
+		if kind == "" || kind == "union" {
+			builder.Imports["reflect"] = true
+		}
+		call = fmt.Sprintf("if %s {\n%s}\n", present, call)
+	}
+	return checks + call
+}
+
+// validateCall validates a field of a generated type, prefixing errors with the name of the field
+func (wsdl *WSDL) validateCall(builder *Builder, field string, tp ElementType) string {
+
+	if tp.BuildIn != "" {
+		return ""
+	}
+
+	builder.Imports["fmt"] = true
+	format := field + ": %w"
+	if wsdl.baseKind(tp) == "" {
+		// errors of structs start with the name of their own field
+		format = field + ".%w"
+	}
+	return fmt.Sprintf("if err := v.%s.Validate(); err != nil {\nreturn fmt.Errorf(%q, err)\n}\n", field, format)
+}
+
+// facetChecks checks a simple type against its base type and the enumeration, patterns, length, bounds and digits
+// of its restriction. Patterns go does not support are not checked, nor is whiteSpace as values are not
+// normalized when decoded.
+func (wsdl *WSDL) facetChecks(builder *Builder, tp ElementType) (string, error) {
+
+	base, ok := wsdl.TypeMap[strings.ToLower(tp.Type)]
+	if !ok {
+		return "", errors.Errorf("Could not find reference of type %v", tp.Type)
+	}
+	kind := wsdl.baseKind(tp)
+
+	checks := ""
+	if base.BuildIn == "" {
+		checks += fmt.Sprintf("if err := %s(v).Validate(); err != nil {\nreturn err\n}\n", base.TypeName())
+	}
+
+	verb := "%v"
+	if kind == "string" {
+		verb = "%q"
+	}
+
+	if len(tp.Enum) > 0 {
+		literals := make([]string, 0, len(tp.Enum))
+		for _, enum := range tp.Enum {
+			switch kind {
+			case "string":
+				literals = append(literals, strconv.Quote(enum))
+			case "int":
+				if _, err := strconv.Atoi(enum); err == nil {
+					literals = append(literals, enum)
+				}
+			}
+		}
+		if len(literals) == len(tp.Enum) {
+			builder.Imports["fmt"] = true
+			message := "value " + verb + " is not one of " + escapeVerbs(strings.Join(tp.Enum, ", "))
+			checks += fmt.Sprintf("switch v {\ncase %s:\ndefault:\nreturn fmt.Errorf(%q, v)\n}\n", strings.Join(literals, ", "), message)
+		}
+	}
+
+	if len(tp.Patterns) > 0 && kind == "string" {
+		expr := tp.patternExpr()
+		if _, err := regexp.Compile(expr); err == nil {
+			varName := lcFirst(tp.TypeName()) + "Pattern"
+			builder.Imports["regexp"] = true
+			builder.Imports["fmt"] = true
+			builder.Decls[varName] = fmt.Sprintf("// %s is the pattern facet of %s\nvar %s = regexp.MustCompile(%q)", varName, tp.TypeName(), varName, expr)
+			message := "value %q does not match pattern " + escapeVerbs(strings.Join(tp.Patterns, "|"))
+			checks += fmt.Sprintf("if !%s.MatchString(string(v)) {\nreturn fmt.Errorf(%q, v)\n}\n", varName, message)
+		}
+	}
+
+	length := ""
+	switch kind {
+	case "string":
+		length = "utf8.RuneCountInString(string(v))"
+	case "soap.Binary", "list":
+		length = "len(v)"
+	}
+	lengthFacets := []struct{ value, failing, message string }{
+		{tp.Length, "!=", "length %v is not "},
+		{tp.MinLength, "<", "length %v is below the minimum length "},
+		{tp.MaxLength, ">", "length %v is above the maximum length "},
+	}
+	for _, facet := range lengthFacets {
+		if _, err := strconv.Atoi(facet.value); err != nil || length == "" {
+			continue
+		}
+		if kind == "string" {
+			builder.Imports["unicode/utf8"] = true
+		}
+		builder.Imports["fmt"] = true
+		checks += fmt.Sprintf("if n := %s; n %s %s {\nreturn fmt.Errorf(%q, n)\n}\n", length, facet.failing, facet.value, facet.message+facet.value)
+	}
+
+	boundFacets := []struct{ value, failing, message string }{
+		{tp.MinInclusive, "<", "value " + verb + " is below the minimum "},
+		{tp.MaxInclusive, ">", "value " + verb + " is above the maximum "},
+		{tp.MinExclusive, "<=", "value " + verb + " is not above "},
+		{tp.MaxExclusive, ">=", "value " + verb + " is not below "},
+	}
+	for _, facet := range boundFacets {
+		switch kind {
+		case "int":
+			if _, err := strconv.Atoi(facet.value); err != nil {
+				continue
+			}
+			builder.Imports["fmt"] = true
+			checks += fmt.Sprintf("if v %s %s {\nreturn fmt.Errorf(%q, v)\n}\n", facet.failing, facet.value, facet.message+facet.value)
+		case "string":
+			// decimals are kept as strings
+			if _, err := strconv.ParseFloat(facet.value, 64); err != nil {
+				continue
+			}
+			builder.Imports["fmt"] = true
+			builder.Imports["strconv"] = true
+			checks += fmt.Sprintf("if f, err := strconv.ParseFloat(string(v), 64); err == nil && f %s %s {\nreturn fmt.Errorf(%q, v)\n}\n", facet.failing, facet.value, facet.message+facet.value)
+		}
+	}
+
+	digits := ""
+	switch kind {
+	case "int":
+		digits = "soap.DecimalDigits(strconv.Itoa(int(v)))"
+	case "string":
+		digits = "soap.DecimalDigits(string(v))"
+	}
+	digitFacets := []struct{ value, results, message string }{
+		{tp.TotalDigits, "n, _, ok", "value " + verb + " has %v digits, more than "},
+		{tp.FractionDigits, "_, n, ok", "value " + verb + " has %v fraction digits, more than "},
+	}
+	for _, facet := range digitFacets {
+		if _, err := strconv.Atoi(facet.value); err != nil || digits == "" {
+			continue
+		}
+		if kind == "int" {
+			builder.Imports["strconv"] = true
+		}
+		builder.Imports["fmt"] = true
+		builder.Imports["github.com/keanpedersen/gowhistler/soap"] = true
+		checks += fmt.Sprintf("if %s := %s; ok && n > %s {\nreturn fmt.Errorf(%q, v, n)\n}\n", facet.results, digits, facet.value, facet.message+facet.value)
+	}
+
+	return checks, nil
+}
+
+// escapeVerbs escapes schema text for use in a format string
+func escapeVerbs(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
@@ -20,6 +20,12 @@ type WSDL struct {
 
 	Elements []Element
 	Types    []ElementType
+
+	// named model groups and attribute groups, by full namespace : name, expanded where they are referenced
+	Groups          map[string]ElementType
+	AttributeGroups map[string]ElementType
+
+	Documents []Document // the WSDL itself followed by every schema it includes or imports
 }
 
 func getPrefixToNamespaceMap(doc *etree.Document) map[string]string {
@@ -35,9 +41,16 @@ func getPrefixToNamespaceMap(doc *etree.Document) map[string]string {
 }
 
 func Parse(url string) (*WSDL, error) {
+	// every parse starts from scratch, so parsing the same WSDL twice yields the same types
+	parsed = make(map[string]bool)
+	gInternalID = 0
+	loaded = nil
+
 	ret := &WSDL{
 		UrlToNameSpaceMapping: make(map[string]string),
 		TypeMap:               make(map[string]ElementType),
+		Groups:                make(map[string]ElementType),
+		AttributeGroups:       make(map[string]ElementType),
 	}
 
 	doc, err := getWSDL(url)
@@ -68,7 +81,19 @@ func Parse(url string) (*WSDL, error) {
 			return nil, err
 		}
 		ret.Elements = append(ret.Elements, elements...)
-		ret.Types = append(ret.Types, types...)
+		for _, tp := range types {
+			if tp.NameSpace == "" {
+				tp.NameSpace = ret.TargetNamespace
+			}
+			switch tp.Group {
+			case "group":
+				ret.Groups[strings.ToLower(tp.FullName())] = tp
+			case "attributeGroup":
+				ret.AttributeGroups[strings.ToLower(tp.FullName())] = tp
+			default:
+				ret.Types = append(ret.Types, tp)
+			}
+		}
 	}
 
 	// parse messages
@@ -110,8 +135,9 @@ func Parse(url string) (*WSDL, error) {
 
 	// build type map
 	for _, tp := range ret.Types {
-		if tp.NameSpace == "" {
-			tp.NameSpace = ret.TargetNamespace
+		tp, err := ret.expandGroups(tp, 0)
+		if err != nil {
+			return nil, err
 		}
 		ret.TypeMap[strings.ToLower(tp.FullName())] = tp
 	}
@@ -122,7 +148,7 @@ func Parse(url string) (*WSDL, error) {
 	ret.TypeMap["http://www.w3.org/2001/xmlschema:int"] = ElementType{BuildIn: "int"}
 	ret.TypeMap["http://www.w3.org/2001/xmlschema:integer"] = ElementType{BuildIn: "int"}
 	ret.TypeMap["http://www.w3.org/2001/xmlschema:datetime"] = ElementType{BuildIn: "time.Time"}
-	ret.TypeMap["http://www.w3.org/2001/xmlschema:base64binary"] = ElementType{BuildIn: "string"}
+	ret.TypeMap["http://www.w3.org/2001/xmlschema:base64binary"] = ElementType{BuildIn: "soap.Binary"}
 	ret.TypeMap["http://www.w3.org/2001/xmlschema:nmtoken"] = ElementType{BuildIn: "string"}
 	ret.TypeMap["http://www.w3.org/2001/xmlschema:ncname"] = ElementType{BuildIn: "string"}
 	ret.TypeMap["http://www.w3.org/2001/xmlschema:boolean"] = ElementType{BuildIn: "bool"}
@@ -133,7 +159,7 @@ func Parse(url string) (*WSDL, error) {
 	ret.TypeMap[":int"] = ElementType{BuildIn: "int"}
 	ret.TypeMap[":integer"] = ElementType{BuildIn: "int"}
 	ret.TypeMap[":datetime"] = ElementType{BuildIn: "time.Time"}
-	ret.TypeMap[":base64binary"] = ElementType{BuildIn: "string"}
+	ret.TypeMap[":base64binary"] = ElementType{BuildIn: "soap.Binary"}
 	ret.TypeMap[":nmtoken"] = ElementType{BuildIn: "string"}
 	ret.TypeMap[":ncname"] = ElementType{BuildIn: "string"}
 	ret.TypeMap[":boolean"] = ElementType{BuildIn: "string"}
@@ -156,13 +182,16 @@ func Parse(url string) (*WSDL, error) {
 		ret.TypeMap[strings.ToLower(elm.FullName())] = tp
 	}
 
+	ret.Documents = loaded
+
 	return ret, nil
 
 }
 
 type MessagePart struct {
 	Name    string
-	Element string
+	Element string // element reference, used by document style bindings
+	Type    string // type reference, used by rpc style bindings
 }
 
 type Message struct {
@@ -179,34 +208,66 @@ type PortOperation struct {
 	Name   string
 	Input  PortOperationComponent
 	Output PortOperationComponent
-	Fault  PortOperationComponent
+	Faults []PortOperationComponent
 }
 
 type PortOperationComponent struct {
 	Message string
 	Name    string
+	Action  string // the WS-Addressing action given by wsaw:Action or wsam:Action
+}
+
+// The namespaces of the WS-Addressing WSDL binding and metadata, which both define an Action attribute
+const (
+	AddressingWSDLNamespace     = "http://www.w3.org/2006/05/addressing/wsdl"
+	AddressingMetadataNamespace = "http://www.w3.org/2007/05/addressing/metadata"
+)
+
+// addressingAction returns the wsaw:Action or wsam:Action of a portType input, output or fault
+func addressingAction(elm *etree.Element) string {
+	for _, attr := range elm.Attr {
+		if attr.Key != "Action" {
+			continue
+		}
+		if ns := attr.NamespaceURI(); ns == AddressingWSDLNamespace || ns == AddressingMetadataNamespace {
+			return attr.Value
+		}
+	}
+	return ""
 }
 
+// Binding styles as given by soap:binding/@style and soap:operation/@style
+const (
+	StyleDocument = "document"
+	StyleRPC      = "rpc"
+)
+
 type Binding struct {
 	Name       string
 	Type       string
+	Style      string
+	Addressing bool // wsaw:UsingAddressing or wsam:Addressing
 	Operations []BindingOperation
 }
 
 type BindingOperation struct {
 	Name       string
 	SoapAction string
+	Style      string // inherited from the binding unless overridden by soap:operation
+	Addressing bool   // inherited from the binding
 	Input      []BindingOperationComponent
 	Output     []BindingOperationComponent
 	Fault      []BindingOperationComponent
 }
 
 type BindingOperationComponent struct {
-	In      string
-	Use     string
-	Parts   []string
-	Message string
-	Name    string
+	In        string
+	Use       string
+	Namespace string
+	Parts     []string
+	Message   string
+	Name      string
+	MimeType  string // the type of a mime:content, sent as an attachment
 }
 
 type Service struct {
@@ -251,25 +312,41 @@ func ParseBinding(elm *etree.Element) (binding Binding, err error) {
 		Type: elm.SelectAttrValue("type", ""),
 	}
 
+	for _, child := range elm.ChildElements() {
+		switch {
+		case child.Tag == "binding":
+			ret.Style = child.SelectAttrValue("style", "")
+		case child.Tag == "UsingAddressing" && child.NamespaceURI() == AddressingWSDLNamespace,
+			child.Tag == "Addressing" && child.NamespaceURI() == AddressingMetadataNamespace:
+			ret.Addressing = true
+		}
+	}
+	if ret.Style == "" {
+		ret.Style = StyleDocument
+	}
+
 	for _, child := range elm.ChildElements() {
 		if child.Tag != "operation" {
 			continue
 		}
 
 		op := BindingOperation{
-			Name: child.SelectAttrValue("name", ""),
+			Name:       child.SelectAttrValue("name", ""),
+			Style:      ret.Style,
+			Addressing: ret.Addressing,
 		}
 
 		for _, child := range child.ChildElements() {
 			switch child.Tag {
 			case "operation":
 				op.SoapAction = child.SelectAttrValue("soapAction", "")
+				op.Style = child.SelectAttrValue("style", op.Style)
 			case "input":
 				op.Input = ParseBindingOperationComponent(child)
 			case "output":
 				op.Output = ParseBindingOperationComponent(child)
 			case "fault":
-				op.Fault = ParseBindingOperationComponent(child)
+				op.Fault = append(op.Fault, ParseBindingOperationComponent(child)...)
 			}
 		}
 
@@ -279,20 +356,35 @@ func ParseBinding(elm *etree.Element) (binding Binding, err error) {
 	return ret, nil
 }
 
+// ParseBindingOperationComponent parses the soap:body, soap:header and soap:fault elements of a binding input,
+// output or fault. The mime:parts of a mime:multipartRelated are flattened into the list, an attachment being
+// a "content" component with the first of its alternative mime:content types.
 func ParseBindingOperationComponent(elm *etree.Element) []BindingOperationComponent {
 	var ret []BindingOperationComponent
 
 	for _, child := range elm.ChildElements() {
+		if child.Tag == "multipartRelated" {
+			for _, mimePart := range child.SelectElements("part") {
+				ret = append(ret, ParseBindingOperationComponent(mimePart)...)
+			}
+			continue
+		}
+		if child.Tag == "content" && len(ret) > 0 && ret[len(ret)-1].In == "content" {
+			continue
+		}
+
 		component := BindingOperationComponent{
-			In:      child.Tag,
-			Use:     child.SelectAttrValue("use", ""),
-			Message: child.SelectAttrValue("message", ""),
-			Name:    child.SelectAttrValue("name", ""),
+			In:        child.Tag,
+			Use:       child.SelectAttrValue("use", ""),
+			Namespace: child.SelectAttrValue("namespace", ""),
+			Message:   child.SelectAttrValue("message", ""),
+			Name:      child.SelectAttrValue("name", ""),
+			MimeType:  child.SelectAttrValue("type", ""),
 		}
 
 		for _, attr := range child.Attr {
 			if attr.Key == "part" || attr.Key == "parts" {
-				component.Parts = append(component.Parts, attr.Value)
+				component.Parts = append(component.Parts, strings.Fields(attr.Value)...)
 			}
 		}
 
@@ -318,12 +410,17 @@ func ParsePort(elm *etree.Element) (port Port, err error) {
 				case "input":
 					op.Input.Message = child.SelectAttrValue("message", "")
 					op.Input.Name = child.SelectAttrValue("name", "")
+					op.Input.Action = addressingAction(child)
 				case "output":
 					op.Output.Message = child.SelectAttrValue("message", "")
 					op.Output.Name = child.SelectAttrValue("name", "")
+					op.Output.Action = addressingAction(child)
 				case "fault":
-					op.Fault.Message = child.SelectAttrValue("message", "")
-					op.Fault.Name = child.SelectAttrValue("name", "")
+					op.Faults = append(op.Faults, PortOperationComponent{
+						Message: child.SelectAttrValue("message", ""),
+						Name:    child.SelectAttrValue("name", ""),
+						Action:  addressingAction(child),
+					})
 				}
 			}
 
@@ -343,10 +440,16 @@ func ParseMesssage(elm *etree.Element, prefixes map[string]string) (msgs Message
 	for _, child := range elm.ChildElements() {
 		if child.Tag == "part" {
 
-			ret.Parts = append(ret.Parts, MessagePart{
-				Name:    child.SelectAttrValue("name", ""),
-				Element: expandNamespace(child.SelectAttrValue("element", ""), prefixes),
-			})
+			part := MessagePart{
+				Name: child.SelectAttrValue("name", ""),
+			}
+			if element := child.SelectAttrValue("element", ""); element != "" {
+				part.Element = expandNamespace(element, prefixes)
+			}
+			if tp := child.SelectAttrValue("type", ""); tp != "" {
+				part.Type = parseTypeString(tp, prefixes)
+			}
+			ret.Parts = append(ret.Parts, part)
 		}
 	}
 
@@ -431,7 +534,7 @@ func ParseSchema(tpelm *etree.Element, targetNamespace string, prefixes map[stri
 			}
 			elements = append(elements, elm)
 			types = append(types, tp...)
-		case "simpleType", "complexType":
+		case "simpleType", "complexType", "group", "attributeGroup":
 			tpElm, err := parseTypeElement(child, prefixes, targetNamespace, source)
 			if err != nil {
 				return nil, nil, err
@@ -460,6 +563,7 @@ func parseElement(node *etree.Element, prefixes map[string]string, defaultNamesp
 	if elm.NameSpace == "" {
 		elm.NameSpace = defaultNamespace
 	}
+	elm.Unqualified = isUnqualified(node)
 
 	tp := node.SelectAttrValue("type", "")
 
@@ -488,6 +592,24 @@ func parseElement(node *etree.Element, prefixes map[string]string, defaultNamesp
 	return elm, tps, nil
 }
 
+// isUnqualified tells whether a local element is in no namespace, by its form or the elementFormDefault of
+// its schema
+func isUnqualified(node *etree.Element) bool {
+
+	if node.Parent() == nil || node.Parent().Tag == "schema" || node.SelectAttr("ref") != nil {
+		return false
+	}
+	if form := node.SelectAttr("form"); form != nil {
+		return form.Value == "unqualified"
+	}
+	for schema := node.Parent(); schema != nil; schema = schema.Parent() {
+		if schema.Tag == "schema" {
+			return schema.SelectAttrValue("elementFormDefault", "unqualified") == "unqualified"
+		}
+	}
+	return false
+}
+
 var gInternalID = 0
 
 func parseTypeElement(node *etree.Element, prefixes map[string]string, defaultNamespace string, source string) ([]ElementType, error) {
@@ -522,19 +644,86 @@ func parseTypeElement(node *etree.Element, prefixes map[string]string, defaultNa
 					if enum.Tag == "enumeration" {
 						tp.Enum = append(tp.Enum, enum.SelectAttrValue("value", ""))
 					}
-					if enum.Tag == "pattern" {
-						tp.Pattern = enum.SelectAttrValue("value", "")
+					value := enum.SelectAttrValue("value", "")
+					switch enum.Tag {
+					case "pattern":
+						tp.Patterns = append(tp.Patterns, value)
+					case "length":
+						tp.Length = value
+					case "minLength":
+						tp.MinLength = value
+					case "maxLength":
+						tp.MaxLength = value
+					case "minInclusive":
+						tp.MinInclusive = value
+					case "maxInclusive":
+						tp.MaxInclusive = value
+					case "minExclusive":
+						tp.MinExclusive = value
+					case "maxExclusive":
+						tp.MaxExclusive = value
+					case "totalDigits":
+						tp.TotalDigits = value
+					case "fractionDigits":
+						tp.FractionDigits = value
+					case "whiteSpace":
+						tp.WhiteSpace = value
+					}
+				}
+			}
+			if child2.Tag == "list" {
+				if itemType := child2.SelectAttrValue("itemType", ""); itemType != "" {
+					tp.ListItem = parseTypeString(itemType, prefixes)
+				}
+				for _, child3 := range child2.ChildElements() {
+					if child3.Tag != "simpleType" {
+						continue
+					}
+					tps, err := parseTypeElement(child3, prefixes, defaultNamespace, source)
+					if err != nil {
+						return ret, err
+					}
+					tp.ListItem = tps[0].NameSpace + ":" + tps[0].Name
+					ret = append(ret, tps...)
+				}
+			}
+			if child2.Tag == "union" {
+				for _, member := range strings.Fields(child2.SelectAttrValue("memberTypes", "")) {
+					tp.UnionMembers = append(tp.UnionMembers, parseTypeString(member, prefixes))
+				}
+				for _, child3 := range child2.ChildElements() {
+					if child3.Tag != "simpleType" {
+						continue
+					}
+					tps, err := parseTypeElement(child3, prefixes, defaultNamespace, source)
+					if err != nil {
+						return ret, err
 					}
+					tp.UnionMembers = append(tp.UnionMembers, tps[0].NameSpace+":"+tps[0].Name)
+					ret = append(ret, tps...)
 				}
 			}
 		}
-	case "complexType":
+	case "complexType", "group", "attributeGroup":
+		if node.Tag != "complexType" {
+			tp.Group = node.Tag
+		}
 		for _, child2 := range node.ChildElements() {
 			if child2.Tag == "annotation" {
 				continue
 			}
+			if child2.Tag == "group" {
+				tp.SubElements = append(tp.SubElements, parseGroupRef(child2, prefixes, source))
+			}
+			if child2.Tag == "attributeGroup" {
+				tp.AttributeGroups = append(tp.AttributeGroups, parseTypeString(child2.SelectAttrValue("ref", ""), prefixes))
+			}
 			if child2.Tag == "sequence" {
 				for _, seq := range child2.ChildElements() {
+					if seq.Tag == "group" {
+						tp.SubElements = append(tp.SubElements, parseGroupRef(seq, prefixes, source))
+						continue
+					}
 					subElm, tps, err := parseElement(seq, prefixes, defaultNamespace, source)
 					if err != nil {
 						return ret, err
@@ -564,10 +753,16 @@ func parseTypeElement(node *etree.Element, prefixes map[string]string, defaultNa
 				if attrType == "" && len(tp.AttributeElements) == 0 {
 					tp.AttributeElements[attrName] = ":string"
 				}
+				if child2.SelectAttrValue("use", "") == "required" {
+					tp.RequiredAttributes = append(tp.RequiredAttributes, attrName)
+				}
 			}
 			if child2.Tag == "choice" {
 				for _, seq := range child2.ChildElements() {
 
+					if seq.Tag == "group" {
+						tp.ChoiceElements = append(tp.ChoiceElements, parseGroupRef(seq, prefixes, source))
+					}
 					if seq.Tag == "element" {
 						subElm, tps, err := parseElement(seq, prefixes, defaultNamespace, source)
 						if err != nil {
@@ -598,6 +793,135 @@ func parseTypeElement(node *etree.Element, prefixes map[string]string, defaultNa
 	return ret, nil
 }
 
+// parseGroupRef parses a reference to a named model group, kept in place of the elements of the group until
+// they are expanded
+func parseGroupRef(node *etree.Element, prefixes map[string]string, source string) Element {
+	return Element{
+		Source:    source,
+		Group:     parseTypeString(node.SelectAttrValue("ref", ""), prefixes),
+		MinOccurs: parseOccurs(node.SelectAttrValue("minOccurs", "1")),
+		MaxOccurs: parseOccurs(node.SelectAttrValue("maxOccurs", "1")),
+	}
+}
+
+// expandGroups replaces the references to named model groups and attribute groups of a type by their content.
+// As types hold a sequence and a single choice of elements, groups are expanded where that keeps their meaning:
+// a group of a single element takes the occurrences of the reference, the elements of other groups in a sequence
+// are optional when the reference is, and choice groups in a choice become alternatives of it. A choice group in
+// a sequence becomes the choice of the type, which is written after the sequence, so it must be the last of the
+// sequence and the only choice. Other uses of groups give an error.
+func (wsdl *WSDL) expandGroups(tp ElementType, depth int) (ElementType, error) {
+
+	if depth > 20 {
+		return tp, errors.Errorf("Groups of %v nest too deep", tp.FullName())
+	}
+
+	group := func(ref string) (ElementType, error) {
+		g, ok := wsdl.Groups[strings.ToLower(ref)]
+		if !ok {
+			return g, errors.Errorf("Could not find group %v", ref)
+		}
+		return wsdl.expandGroups(g, depth+1)
+	}
+
+	var subs, choices []Element
+	choiceGroup := "" // the group giving the choice of the type, which no elements may follow
+	for _, sub := range tp.SubElements {
+		g := ElementType{SubElements: []Element{sub}}
+		if sub.Group != "" {
+			var err error
+			if g, err = group(sub.Group); err != nil {
+				return tp, err
+			}
+			if single, ok := singleElement(g, sub); ok {
+				g = ElementType{SubElements: []Element{single}}
+			} else if sub.MaxOccurs != 1 {
+				return tp, errors.Errorf("Repeated group %v in %v is not supported", sub.Group, tp.FullName())
+			} else if sub.MinOccurs == 0 && len(g.ChoiceElements) > 0 {
+				return tp, errors.Errorf("Optional choice group %v in %v is not supported", sub.Group, tp.FullName())
+			}
+		}
+
+		if choiceGroup != "" && len(g.SubElements) > 0 {
+			return tp, errors.Errorf("Elements following choice group %v in %v are not supported", choiceGroup, tp.FullName())
+		}
+		for _, groupSub := range g.SubElements {
+			if sub.Group != "" && sub.MinOccurs == 0 {
+				groupSub.MinOccurs = 0
+			}
+			subs = append(subs, groupSub)
+		}
+		if len(g.ChoiceElements) > 0 {
+			if len(choices) > 0 || len(tp.ChoiceElements) > 0 {
+				return tp, errors.Errorf("Choice group %v next to another choice in %v is not supported", sub.Group, tp.FullName())
+			}
+			choices, choiceGroup = append(choices, g.ChoiceElements...), sub.Group
+		}
+	}
+	for _, sub := range tp.ChoiceElements {
+		if sub.Group == "" {
+			choices = append(choices, sub)
+			continue
+		}
+		g, err := group(sub.Group)
+		if err != nil {
+			return tp, err
+		}
+		if single, ok := singleElement(g, sub); ok {
+			choices = append(choices, single)
+			continue
+		}
+		if len(g.SubElements) > 0 {
+			return tp, errors.Errorf("Sequence group %v in a choice of %v is not supported", sub.Group, tp.FullName())
+		}
+		if sub.MinOccurs != 1 || sub.MaxOccurs != 1 {
+			return tp, errors.Errorf("Choice group %v in a choice of %v must occur once", sub.Group, tp.FullName())
+		}
+		choices = append(choices, g.ChoiceElements...)
+	}
+	tp.SubElements, tp.ChoiceElements = subs, choices
+
+	for _, ref := range tp.AttributeGroups {
+		g, ok := wsdl.AttributeGroups[strings.ToLower(ref)]
+		if !ok {
+			return tp, errors.Errorf("Could not find attribute group %v", ref)
+		}
+		g, err := wsdl.expandGroups(g, depth+1)
+		if err != nil {
+			return tp, err
+		}
+		attributes := make(map[string]string)
+		for name, attrType := range tp.AttributeElements {
+			attributes[name] = attrType
+		}
+		for name, attrType := range g.AttributeElements {
+			attributes[name] = attrType
+		}
+		tp.AttributeElements = attributes
+		tp.RequiredAttributes = append(append([]string{}, tp.RequiredAttributes...), g.RequiredAttributes...)
+	}
+	tp.AttributeGroups = nil
+
+	return tp, nil
+}
+
+// singleElement returns the element of a group holding a single element, with the occurrences of the group
+// reference multiplied in. MaxOccurs 0 is unbounded.
+func singleElement(g ElementType, ref Element) (Element, bool) {
+
+	if len(g.SubElements)+len(g.ChoiceElements) != 1 {
+		return Element{}, false
+	}
+	elm := append(g.SubElements, g.ChoiceElements...)[0]
+	elm.MinOccurs *= ref.MinOccurs
+	if elm.MaxOccurs == 0 || ref.MaxOccurs == 0 {
+		elm.MaxOccurs = 0
+	} else {
+		elm.MaxOccurs *= ref.MaxOccurs
+	}
+	return elm, true
+}
+
 func parseTypeString(tp string, prefixes map[string]string) string {
 	ns, n := nsSplit(tp)
 	ns = prefixes[ns]
@@ -622,6 +946,12 @@ type Element struct {
 	MaxOccurs          int
 	ReferenceNameSpace string
 	Reference          string
+
+	// Unqualified local elements are in no namespace, NameSpace being the namespace of their schema
+	Unqualified bool
+
+	// Group is the model group referenced in place of elements, until it is expanded
+	Group string
 }
 
 func (e Element) FullName() string {
@@ -629,17 +959,53 @@ func (e Element) FullName() string {
 }
 
 type ElementType struct {
-	Source            string
-	NameSpace         string
-	Name              string
-	Internal          bool
-	BuildIn           string
-	Type              string
-	SubElements       []Element
-	ChoiceElements    []Element
-	AttributeElements map[string]string
-	Enum              []string
-	Pattern           string
+	Source             string
+	NameSpace          string
+	Name               string
+	Internal           bool
+	BuildIn            string
+	Type               string
+	SubElements        []Element
+	ChoiceElements     []Element
+	AttributeElements  map[string]string
+	RequiredAttributes []string
+	Enum               []string
+
+	// Group is "group" or "attributeGroup" for named groups, AttributeGroups the attribute groups referenced
+	// until they are expanded
+	Group           string
+	AttributeGroups []string
+
+	// ListItem is the item type of an xs:list, UnionMembers the member types of an xs:union in order
+	ListItem     string
+	UnionMembers []string
+
+	// Patterns of a restriction, a value must match one of them
+	Patterns []string
+
+	// facets of restrictions as written in the schema, empty when not given
+	Length         string
+	MinLength      string
+	MaxLength      string
+	MinInclusive   string
+	MaxInclusive   string
+	MinExclusive   string
+	MaxExclusive   string
+	TotalDigits    string
+	FractionDigits string
+	WhiteSpace     string
+}
+
+// patternExpr returns a go regular expression matching the whole value against any of the patterns
+func (e ElementType) patternExpr() string {
+	if len(e.Patterns) == 1 {
+		return "^(?:" + e.Patterns[0] + ")$"
+	}
+	alternatives := make([]string, len(e.Patterns))
+	for i, pattern := range e.Patterns {
+		alternatives[i] = "(?:" + pattern + ")"
+	}
+	return "^(?:" + strings.Join(alternatives, "|") + ")$"
 }
 
 func (e ElementType) FullName() string {
@@ -667,3 +1033,7 @@ func makeTypeName(s string) string {
 func ucFirst(s string) string {
 	return strings.ToUpper(s[:1]) + s[1:]
 }
+
+func lcFirst(s string) string {
+	return strings.ToLower(s[:1]) + s[1:]
+}